@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+const ( // for the build info metric
+	modulePathLabel    = "module_path"
+	moduleVersionLabel = "module_version"
+	vcsRevisionLabel   = "vcs_revision"
+	goVersionLabel     = "go_version"
+)
+
+const ( // for the const labels
+	serviceVersionLabel = "service_version"
+	environmentLabel    = "environment"
+)
+
+// buildInfo returns the labels of the build info metric, read from the build information embedded
+// in the binary. The labels are empty when the information is not available.
+func buildInfo() map[string]string {
+	labels := map[string]string{
+		modulePathLabel:    "",
+		moduleVersionLabel: "",
+		vcsRevisionLabel:   "",
+		goVersionLabel:     runtime.Version(),
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return labels
+	}
+	labels[modulePathLabel] = bi.Main.Path
+	labels[moduleVersionLabel] = bi.Main.Version
+	labels[goVersionLabel] = bi.GoVersion
+	for _, setting := range bi.Settings {
+		if setting.Key == "vcs.revision" {
+			labels[vcsRevisionLabel] = setting.Value
+		}
+	}
+	return labels
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// OverflowLabelValue replaces the values of a metric label once the label has reached its
+	// cardinality limit, see [WithCardinalityLimit].
+	OverflowLabelValue = "__other__"
+
+	// OtherMethod replaces HTTP methods that are not defined by RFC 9110 or RFC 5789, following the
+	// OpenTelemetry semantic conventions.
+	OtherMethod = "_OTHER"
+)
+
+// knownMethods are the HTTP methods recorded as is in the metrics.
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// metricMethod returns the value of the http_method label for the method.
+func metricMethod(method string) string {
+	if knownMethods[method] {
+		return method
+	}
+	return OtherMethod
+}
+
+// cardinalityLimiter caps the number of distinct values of each metric label.
+type cardinalityLimiter struct {
+	limit int
+	ttl   time.Duration // the values not recorded for the TTL are released, when positive
+
+	mu        sync.Mutex
+	values    map[string]map[string]*limitedValue
+	nextSweep time.Time
+}
+
+// limitedValue is a label value counted toward the limit.
+type limitedValue struct {
+	lastSeen time.Time
+	inFlight int
+}
+
+func newCardinalityLimiter(limit int, ttl time.Duration) *cardinalityLimiter {
+	return &cardinalityLimiter{limit: limit, ttl: ttl, values: make(map[string]map[string]*limitedValue)}
+}
+
+// value returns the value if it was seen before or the label is below its limit. Otherwise, it
+// returns [OverflowLabelValue] and false. Each accepted value is in flight until [done] is called.
+func (cl *cardinalityLimiter) value(label, value string) (string, bool) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	seen, ok := cl.values[label]
+	if !ok {
+		seen = make(map[string]*limitedValue)
+		cl.values[label] = seen
+	}
+	now := time.Now()
+	if v, ok := seen[value]; ok {
+		v.lastSeen = now
+		v.inFlight++
+		return value, true
+	}
+	if len(seen) >= cl.limit {
+		cl.release(now)
+	}
+	if len(seen) >= cl.limit {
+		return OverflowLabelValue, false
+	}
+	seen[value] = &limitedValue{lastSeen: now, inFlight: 1}
+	return value, true
+}
+
+// done records that the request of a value returned by [value] has been handled.
+func (cl *cardinalityLimiter) done(label, value string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if v, ok := cl.values[label][value]; ok {
+		v.lastSeen = time.Now()
+		v.inFlight--
+	}
+}
+
+// release frees the values that have not been recorded for the TTL, as their series expire, see
+// [WithSeriesTTL]. The values are scanned at most every half TTL, like the series.
+func (cl *cardinalityLimiter) release(now time.Time) {
+	if cl.ttl <= 0 || now.Before(cl.nextSweep) {
+		return
+	}
+	cl.nextSweep = now.Add(cl.ttl / 2)
+	for _, seen := range cl.values {
+		for value, v := range seen {
+			if v.inFlight <= 0 && now.Sub(v.lastSeen) >= cl.ttl {
+				delete(seen, value)
+			}
+		}
+	}
+}
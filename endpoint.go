@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultMetricsPath is the default path of the metrics endpoint mounted by [MountMetrics].
+const DefaultMetricsPath = "/metrics"
+
+// metricsEndpointName is the name gin reports for the handler of the metrics endpoint, see
+// [gin.Context.HandlerName]. The middlewares of this package use it to skip the endpoint.
+var metricsEndpointName = handlerName((*metricsEndpoint)(nil).serve)
+
+// metricsEndpoint serves the metrics of a registry.
+type metricsEndpoint struct {
+	handler http.Handler
+	options endpointOptions
+}
+
+// MountMetrics serves the metrics of the registry on the router, at [DefaultMetricsPath] unless
+// configured otherwise. The metrics are served in the OpenMetrics format, which includes the trace
+// exemplars, to the scrapers that accept it, and compressed with gzip. The endpoint can be protected
+// with [WithBasicAuth] or [WithBearerToken].
+//
+// Requests to the endpoint are not instrumented by the middlewares of this package.
+func MountMetrics(router gin.IRoutes, registry *prometheus.Registry, opts ...EndpointOption) error {
+	options := newEndpointOptions(opts...)
+	switch {
+	case router == nil:
+		return errors.New("router is nil")
+	case registry == nil:
+		return errors.New("registry is nil")
+	case !strings.HasPrefix(options.path, "/"):
+		return errors.New("metrics path must start with /")
+	case options.basicAuth && options.bearerAuth:
+		return errors.New("basic auth and bearer token are mutually exclusive")
+	case options.basicAuth && (options.username == "" || options.password == ""):
+		return errors.New("basic auth username and password must not be empty")
+	case options.bearerAuth && options.bearerToken == "":
+		return errors.New("bearer token must not be empty")
+	}
+
+	endpoint := &metricsEndpoint{
+		handler: promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+			EnableOpenMetrics:  true,
+			DisableCompression: options.disableCompression,
+		}),
+		options: options,
+	}
+	router.GET(options.path, endpoint.serve)
+	return nil
+}
+
+func (e *metricsEndpoint) serve(c *gin.Context) {
+	if !e.authorized(c.Request) {
+		if e.options.basicAuth {
+			c.Header("WWW-Authenticate", `Basic realm="metrics"`)
+		} else {
+			c.Header("WWW-Authenticate", "Bearer")
+		}
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	e.handler.ServeHTTP(c.Writer, c.Request)
+}
+
+// authorized reports whether the request carries the credentials of the endpoint, if it has any.
+func (e *metricsEndpoint) authorized(r *http.Request) bool {
+	switch {
+	case e.options.basicAuth:
+		username, password, ok := r.BasicAuth()
+		return ok && secureCompare(username, e.options.username) && secureCompare(password, e.options.password)
+	case e.options.bearerAuth:
+		// the authentication scheme is case-insensitive, see RFC 7235
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		return ok && strings.EqualFold(scheme, "Bearer") && secureCompare(token, e.options.bearerToken)
+	default:
+		return true
+	}
+}
+
+func secureCompare(given, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// skipRequest reports whether the middlewares should not instrument the request, because it is
+// for the metrics endpoint or one of the excluded paths.
+func skipRequest(c *gin.Context, excludePaths []string) bool {
+	return c.HandlerName() == metricsEndpointName || containsPath(excludePaths, c.Request.URL.Path)
+}
+
+// handlerName returns the name of the handler, the same way gin does.
+func handlerName(handler gin.HandlerFunc) string {
+	return runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+}
@@ -0,0 +1,125 @@
+package middleware_test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gonic "github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twistingmercury/middleware/v2"
+)
+
+func TestMountMetrics(t *testing.T) {
+	initializeTests(t)
+	defer resetTests()
+
+	registry := prometheus.NewRegistry()
+	mc, err := middleware.NewMetricsCollector(registry, middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName))
+	require.NoError(t, err)
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware(), middleware.OtelTracing(), middleware.Logging())
+	require.NoError(t, middleware.MountMetrics(r, registry))
+	r.GET("/test", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+	lbuffer.Reset()
+
+	req := httptest.NewRequest(http.MethodGet, middleware.DefaultMetricsPath, nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/openmetrics-text")
+	assert.Contains(t, w.Body.String(), "unit_test_total_calls")
+	assert.Equal(t, []string{"/test"}, labelValues(t, registry, "unit_test_total_calls", "http_path"),
+		"the metrics endpoint should not be instrumented")
+	assert.Empty(t, lbuffer.String(), "the metrics endpoint should not be logged")
+}
+
+func TestMountMetricsAuthorization(t *testing.T) {
+	testCases := []struct {
+		name      string
+		opt       middleware.EndpointOption
+		authorize func(r *http.Request)
+	}{
+		{
+			name:      "basic auth",
+			opt:       middleware.WithBasicAuth("prometheus", "secret"),
+			authorize: func(r *http.Request) { r.SetBasicAuth("prometheus", "secret") },
+		},
+		{
+			name:      "bearer token",
+			opt:       middleware.WithBearerToken("secret"),
+			authorize: func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") },
+		},
+		{
+			name:      "bearer token with lowercase scheme",
+			opt:       middleware.WithBearerToken("secret"),
+			authorize: func(r *http.Request) { r.Header.Set("Authorization", "bearer secret") },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gonic.SetMode(gonic.TestMode)
+			r := gonic.New()
+			require.NoError(t, middleware.MountMetrics(r, prometheus.NewRegistry(), tc.opt, middleware.WithMetricsPath("/internal/metrics")))
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/internal/metrics", nil))
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+
+			req := httptest.NewRequest(http.MethodGet, "/internal/metrics", nil)
+			tc.authorize(req)
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
+
+func TestMountMetricsCompression(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "unit_test_counter", Help: "a test counter"})
+	registry.MustRegister(counter)
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	require.NoError(t, middleware.MountMetrics(r, registry))
+
+	req := httptest.NewRequest(http.MethodGet, middleware.DefaultMetricsPath, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	gr, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "unit_test_counter")
+}
+
+func TestMountMetricsErrors(t *testing.T) {
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+
+	assert.Error(t, middleware.MountMetrics(r, nil))
+	assert.Error(t, middleware.MountMetrics(r, prometheus.NewRegistry(), middleware.WithMetricsPath("metrics")))
+	assert.Error(t, middleware.MountMetrics(r, prometheus.NewRegistry(),
+		middleware.WithBasicAuth("prometheus", "secret"), middleware.WithBearerToken("secret")))
+	assert.Error(t, middleware.MountMetrics(r, prometheus.NewRegistry(), middleware.WithBasicAuth("", "secret")))
+	assert.Error(t, middleware.MountMetrics(r, prometheus.NewRegistry(), middleware.WithBasicAuth("prometheus", "")))
+	assert.Error(t, middleware.MountMetrics(r, prometheus.NewRegistry(), middleware.WithBearerToken("")))
+}
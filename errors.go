@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const ( // for gin error properties
+	GinErrors       = "gin.errors"
+	GinErrorType    = "type"
+	GinErrorMessage = "message"
+	GinErrorMeta    = "meta"
+)
+
+// ginErrorType returns the name of the type of a gin error: bind, render, public, private or other.
+func ginErrorType(err *gin.Error) string {
+	switch {
+	case err.IsType(gin.ErrorTypeBind):
+		return "bind"
+	case err.IsType(gin.ErrorTypeRender):
+		return "render"
+	case err.IsType(gin.ErrorTypePublic):
+		return "public"
+	case err.IsType(gin.ErrorTypePrivate):
+		return "private"
+	default:
+		return "other"
+	}
+}
+
+// ginErrorTypes returns the type names of the gin errors, in order.
+func ginErrorTypes(errs []*gin.Error) []string {
+	types := make([]string, len(errs))
+	for i, err := range errs {
+		types[i] = ginErrorType(err)
+	}
+	return types
+}
+
+// ginErrorEntries returns the gin errors as structured log entries.
+func ginErrorEntries(errs []*gin.Error) []map[string]any {
+	entries := make([]map[string]any, len(errs))
+	for i, err := range errs {
+		entries[i] = map[string]any{
+			GinErrorType:    ginErrorType(err),
+			GinErrorMessage: err.Error(),
+		}
+		if err.Meta != nil {
+			entries[i][GinErrorMeta] = err.Meta
+		}
+	}
+	return entries
+}
+
+// recordGinErrors records each gin error as an exception event on the span, and sets the error.type
+// attribute of the span to the type of the last one. If withStack is true, the stack trace of the
+// errors that carry one is recorded as well, see [WithErrorStackTraces].
+func recordGinErrors(span oteltrace.Span, errs []*gin.Error, withStack bool) {
+	var errorType string
+	for _, err := range errs {
+		if err == nil || err.Err == nil {
+			continue
+		}
+		attrs := []attribute.KeyValue{attribute.String(ginErrorTypeAttribute, ginErrorType(err))}
+		if withStack {
+			if stack := errorStackTrace(err.Err); stack != "" {
+				attrs = append(attrs, semconv.ExceptionStacktrace(stack))
+			}
+		}
+		span.RecordError(err.Err, oteltrace.WithAttributes(attrs...))
+		errorType = fmt.Sprintf("%T", err.Err)
+	}
+	if errorType != "" {
+		span.SetAttributes(semconv.ErrorTypeKey.String(errorType))
+	}
+}
+
+// errorStackTrace returns the stack trace carried by the error or one it wraps, i.e. the first one
+// with a StackTrace method, such as the errors of github.com/pkg/errors, formatted with %+v. It
+// returns an empty string if there is none.
+func errorStackTrace(err error) string {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if reflect.ValueOf(e).MethodByName("StackTrace").IsValid() {
+			return fmt.Sprintf("%+v", e)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package middleware_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gonic "github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twistingmercury/middleware/v2"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestGinErrors(t *testing.T) {
+	initializeTests(t)
+	defer resetTests()
+
+	registry := prometheus.NewRegistry()
+	mc, err := middleware.NewMetricsCollector(registry, middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName))
+	require.NoError(t, err)
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware(), middleware.Logging())
+	r.POST("/users/:id", func(c *gonic.Context) {
+		_ = c.Error(errors.New("invalid payload")).SetType(gonic.ErrorTypeBind).SetMeta(map[string]string{"field": "name"})
+		_ = c.Error(errors.New("database unavailable"))
+		c.Status(http.StatusBadRequest)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/42", nil))
+
+	assert.ElementsMatch(t, []string{"bind", "private"}, labelValues(t, registry, "unit_test_gin_errors_total", "error_type"))
+	assert.Equal(t, []string{"/users/:id", "/users/:id"}, labelValues(t, registry, "unit_test_gin_errors_total", "http_path"))
+
+	entries := logEntries(t)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "error", entries[0]["level"])
+	assert.Equal(t, []any{
+		map[string]any{
+			middleware.GinErrorType:    "bind",
+			middleware.GinErrorMessage: "invalid payload",
+			middleware.GinErrorMeta:    map[string]any{"field": "name"},
+		},
+		map[string]any{
+			middleware.GinErrorType:    "private",
+			middleware.GinErrorMessage: "database unavailable",
+		},
+	}, entries[0][middleware.GinErrors])
+}
+
+// stackError is an error carrying a stack trace, like the errors of github.com/pkg/errors.
+type stackError struct {
+	error
+}
+
+func (e stackError) StackTrace() []uintptr {
+	return nil
+}
+
+func (e stackError) Format(s fmt.State, verb rune) {
+	_, _ = fmt.Fprint(s, e.Error())
+	if s.Flag('+') {
+		_, _ = fmt.Fprint(s, "\nmain.handler\n\t/app/main.go:42")
+	}
+}
+
+func TestOtelTracingRecordsGinErrors(t *testing.T) {
+	testCases := []struct {
+		name      string
+		opts      []middleware.TracingOption
+		withStack bool
+	}{
+		{name: "without stack traces"},
+		{name: "with stack traces", opts: []middleware.TracingOption{middleware.WithErrorStackTraces()}, withStack: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			spans := recordSpans(t)
+			defer resetTests()
+
+			gonic.SetMode(gonic.TestMode)
+			r := gonic.New()
+			r.Use(middleware.OtelTracingWithOptions(tc.opts...))
+			r.POST("/users/:id", func(c *gonic.Context) {
+				_ = c.Error(errors.New("invalid payload")).SetType(gonic.ErrorTypeBind)
+				_ = c.Error(fmt.Errorf("saving user: %w", stackError{errors.New("database unavailable")}))
+				c.Status(http.StatusBadRequest)
+			})
+
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users/42", nil))
+
+			stubs := spans()
+			require.Len(t, stubs, 1)
+			var exceptions []attribute.Set
+			for _, event := range stubs[0].Events {
+				if event.Name == "exception" {
+					exceptions = append(exceptions, attribute.NewSet(event.Attributes...))
+				}
+			}
+			require.Len(t, exceptions, 2)
+			assertAttribute(t, exceptions[0], "exception.type", attribute.StringValue("*errors.errorString"))
+			assertAttribute(t, exceptions[0], "exception.message", attribute.StringValue("invalid payload"))
+			assertAttribute(t, exceptions[0], "gin.error.type", attribute.StringValue("bind"))
+			assertAttribute(t, exceptions[1], "exception.type", attribute.StringValue("*fmt.wrapError"))
+			assertAttribute(t, exceptions[1], "exception.message", attribute.StringValue("saving user: database unavailable"))
+			assertAttribute(t, exceptions[1], "gin.error.type", attribute.StringValue("private"))
+
+			_, ok := exceptions[0].Value("exception.stacktrace")
+			assert.False(t, ok, "errors without a stack trace should not have one")
+			stack, ok := exceptions[1].Value("exception.stacktrace")
+			assert.Equal(t, tc.withStack, ok)
+			if tc.withStack {
+				assert.Contains(t, stack.AsString(), "/app/main.go:42")
+			}
+
+			assertAttribute(t, spanAttributes(stubs[0]), "error.type", attribute.StringValue("*fmt.wrapError"))
+		})
+	}
+}
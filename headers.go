@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const ( // for the response headers
+	TraceResponseHeader = "traceresponse"
+	TraceIDHeader       = "X-Trace-Id"
+	ServerTimingHeader  = "Server-Timing"
+)
+
+// serverTimingTotal is the name of the Server-Timing metric holding the duration of the handlers.
+const serverTimingTotal = "total"
+
+// serverTimingKey is the key of the [gin.Context] under which [AddServerTiming] stores the timings
+// registered by the handlers.
+const serverTimingKey = "github.com/twistingmercury/middleware/v2/server-timing"
+
+type serverTiming struct {
+	name     string
+	duration time.Duration
+}
+
+// AddServerTiming registers the duration of a step of the handling of the request, e.g. a database
+// query, to be included in the Server-Timing response header, see [WithServerTiming]. The name must
+// be a token, i.e. without spaces, commas or semicolons. The timings registered after the response
+// headers are written are not included.
+func AddServerTiming(c *gin.Context, name string, duration time.Duration) {
+	var timings []serverTiming
+	if v, ok := c.Get(serverTimingKey); ok {
+		timings, _ = v.([]serverTiming)
+	}
+	c.Set(serverTimingKey, append(timings, serverTiming{name: name, duration: duration}))
+}
+
+// writeResponseHeaders writes the trace and timing headers enabled by the options to the response
+// of the request handled since start. It is called right before the response headers are written.
+func writeResponseHeaders(c *gin.Context, options tracingOptions, span oteltrace.Span, start time.Time) {
+	if sc := span.SpanContext(); sc.IsValid() {
+		if options.traceResponseHeader {
+			c.Header(TraceResponseHeader, fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags()))
+		}
+		if options.traceIDHeader != "" {
+			c.Header(options.traceIDHeader, sc.TraceID().String())
+		}
+	}
+	if options.serverTiming {
+		c.Header(ServerTimingHeader, serverTimingValue(c, time.Since(start)))
+	}
+}
+
+// serverTimingValue returns the value of the Server-Timing header: the total duration, followed by
+// the timings registered with [AddServerTiming], in milliseconds.
+func serverTimingValue(c *gin.Context, total time.Duration) string {
+	metrics := []string{formatServerTiming(serverTimingTotal, total)}
+	if v, ok := c.Get(serverTimingKey); ok {
+		timings, _ := v.([]serverTiming)
+		for _, t := range timings {
+			metrics = append(metrics, formatServerTiming(t.name, t.duration))
+		}
+	}
+	return strings.Join(metrics, ", ")
+}
+
+func formatServerTiming(name string, duration time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.3f", name, float64(duration)/float64(time.Millisecond))
+}
@@ -0,0 +1,83 @@
+package middleware_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	gonic "github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twistingmercury/middleware/v2"
+)
+
+func TestOtelTracingResponseHeaders(t *testing.T) {
+	testCases := []struct {
+		name    string
+		handler gonic.HandlerFunc
+	}{
+		{
+			name: "written response",
+			handler: func(c *gonic.Context) {
+				middleware.AddServerTiming(c, "db", 12*time.Millisecond)
+				c.String(http.StatusOK, "hello")
+				middleware.AddServerTiming(c, "late", time.Millisecond)
+			},
+		},
+		{
+			name: "status only",
+			handler: func(c *gonic.Context) {
+				middleware.AddServerTiming(c, "db", 12*time.Millisecond)
+				c.Status(http.StatusNoContent)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			spans := recordSpans(t)
+			defer resetTests()
+
+			gonic.SetMode(gonic.TestMode)
+			r := gonic.New()
+			r.Use(middleware.OtelTracingWithOptions(
+				middleware.WithTraceResponseHeader(),
+				middleware.WithTraceIDHeader(""),
+				middleware.WithServerTiming()))
+			r.GET("/test", tc.handler)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+			stubs := spans()
+			require.Len(t, stubs, 1)
+			sc := stubs[0].SpanContext
+			assert.Equal(t, fmt.Sprintf("00-%s-%s-01", sc.TraceID(), sc.SpanID()), w.Header().Get(middleware.TraceResponseHeader))
+			assert.Equal(t, sc.TraceID().String(), w.Header().Get(middleware.TraceIDHeader))
+			assert.Regexp(t, regexp.MustCompile(`^total;dur=\d+\.\d{3}, db;dur=12\.000$`), w.Header().Get(middleware.ServerTimingHeader))
+		})
+	}
+}
+
+func TestOtelTracingWithoutResponseHeaders(t *testing.T) {
+	initializeTests(t)
+	defer resetTests()
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(middleware.OtelTracingWithOptions(middleware.WithTraceIDHeader("X-Request-Trace")))
+	r.GET("/test", func(c *gonic.Context) {
+		c.String(http.StatusOK, "hello")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	assert.Len(t, w.Header().Get("X-Request-Trace"), 32)
+	assert.Empty(t, w.Header().Get(middleware.TraceIDHeader))
+	assert.Empty(t, w.Header().Get(middleware.TraceResponseHeader))
+	assert.Empty(t, w.Header().Get(middleware.ServerTimingHeader))
+}
@@ -0,0 +1,317 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsCollector records the metrics of the requests handled by one or more gin routers.
+// Each collector owns its metrics, so several collectors can coexist in the same process.
+// The metrics are recorded by a backend chosen when the collector is created, see
+// [NewMetricsCollector] for Prometheus, [NewOtelMetricsCollector] for OpenTelemetry and
+// [NewStatsDMetricsCollector] for StatsD.
+type MetricsCollector struct {
+	options metricsOptions
+	sink    metricsSink
+	limiter *cardinalityLimiter
+}
+
+// metricsSink is a metrics backend of a [MetricsCollector].
+type metricsSink interface {
+	// requestStarted is called before the request is handled.
+	requestStarted(ctx context.Context, req requestInfo)
+
+	// requestFinished is called after the request has been handled. The context carries the span of
+	// the request, if any.
+	requestFinished(ctx context.Context, req requestInfo, res requestResult)
+
+	// labelOverflowed is called when the value of the label is replaced by [OverflowLabelValue].
+	labelOverflowed(ctx context.Context, label string)
+}
+
+// requestInfo describes a request, as known before it is handled.
+type requestInfo struct {
+	path            string // the value of the http_path label, see [PathLabelMode]
+	route           string // the matched gin route template, or empty when unmatched
+	method          string
+	scheme          string
+	protocolVersion string
+	labels          []string // the values of the custom labels, in the order of the extractors
+}
+
+// requestResult holds the measurements of a handled request.
+type requestResult struct {
+	status          int
+	duration        time.Duration
+	timeToFirstByte time.Duration
+	requestSize     int64
+	responseSize    int64
+	panicked        bool
+	errorTypes      []string // the types of the gin errors, see [ginErrorType]
+	failed          bool     // whether the status is mapped to an error, see [StatusMapper]
+
+	objective *Objective // the objective of the route, or nil if it has none
+	apdexZone string     // the Apdex zone of the request, when its route has an objective
+	good      bool       // whether the request is a good event of the objective
+}
+
+// NewMetricsCollector creates a [MetricsCollector] that records Prometheus metrics and registers
+// them with the registry. The namespace and the API name must be provided using [WithNamespace]
+// and [WithAPIName]. If metrics with the same names and labels are already registered, for
+// example by a collector for another router, the existing metrics are reused, unless the series
+// of either collector expire, see [WithSeriesTTL].
+func NewMetricsCollector(registry *prometheus.Registry, opts ...MetricsOption) (*MetricsCollector, error) {
+	options := newMetricsOptions(opts...)
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	sink, err := newPrometheusSink(registry, options)
+	if err != nil {
+		return nil, err
+	}
+	mc := newMetricsCollector(options, sink)
+	if mc.limiter != nil {
+		// the label values are released along with their series
+		mc.limiter.ttl = options.seriesTTL
+	}
+	return mc, nil
+}
+
+// Close releases the resources of the collector, e.g. it sends the metrics buffered by the StatsD
+// backend, or pushes the metrics to the Pushgateway one last time. Call it when the service shuts
+// down; the middleware must not be used once the collector is closed.
+func (mc *MetricsCollector) Close() error {
+	if closer, ok := mc.sink.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func newMetricsCollector(options metricsOptions, sink metricsSink) *MetricsCollector {
+	mc := &MetricsCollector{options: options, sink: sink}
+	if options.cardinalityLimit > 0 {
+		mc.limiter = newCardinalityLimiter(options.cardinalityLimit, 0)
+	}
+	return mc
+}
+
+// PrometheusMetrics returns the metrics middleware used by the Prometheus software.
+func PrometheusMetrics(registry *prometheus.Registry, namespace string, apiname string, excludePaths ...string) gin.HandlerFunc {
+	return PrometheusMetricsWithOptions(registry, namespace, apiname, WithExcludedPaths(excludePaths...))
+}
+
+// PrometheusMetricsWithOptions returns the metrics middleware used by the Prometheus software,
+// configured by the provided [MetricsOption] values. It panics if the metrics cannot be created;
+// use [NewMetricsCollector] to handle the error instead. It also panics if [WithPushgateway] or
+// [WithSeriesTTL] is used, since the collector could not be closed to push the metrics on shutdown,
+// or to stop the expiry of the series.
+func PrometheusMetricsWithOptions(registry *prometheus.Registry, namespace string, apiname string, opts ...MetricsOption) gin.HandlerFunc {
+	opts = append([]MetricsOption{WithNamespace(namespace), WithAPIName(apiname)}, opts...)
+	options := newMetricsOptions(opts...)
+	if options.pushURL != "" {
+		panic(errors.New("the pushgateway requires closing the collector on shutdown; use NewMetricsCollector"))
+	}
+	if options.seriesTTL > 0 {
+		panic(errors.New("the series ttl requires closing the collector on shutdown; use NewMetricsCollector"))
+	}
+	mc, err := NewMetricsCollector(registry, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return mc.Middleware()
+}
+
+// Metrics provides the prometheus metrics that are to be tracked.
+//
+// Deprecated: the metrics are owned by a [MetricsCollector], see [NewMetricsCollector]. Metrics
+// returns new vectors, built with the default options and without namespace, that are neither
+// registered nor recorded by any middleware.
+func Metrics() (*prometheus.GaugeVec, *prometheus.CounterVec, *prometheus.HistogramVec) {
+	options := newMetricsOptions()
+	statusLabels := []string{pathLabel, methodLabel, statusLabel}
+
+	concurrentCalls := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "concurrent_calls",
+		Help: "the count of concurrent calls to the APIs, grouped by path and http method"},
+		[]string{pathLabel, methodLabel})
+
+	totalCalls := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "total_calls",
+		Help: "The count of all call to the API, grouped by path, http method, and status code"},
+		statusLabels)
+
+	callDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "call_duration",
+		Help:    "The duration in milliseconds calls to the API, grouped by path, http method, and status code",
+		Buckets: options.durationBuckets},
+		statusLabels)
+
+	return concurrentCalls, totalCalls, callDuration
+}
+
+// Middleware returns the gin middleware that records the metrics of each request.
+func (mc *MetricsCollector) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if skipRequest(c, mc.options.excludePaths) {
+			c.Next()
+			return
+		}
+
+		req := mc.limitCardinality(c, newRequestInfo(c, mc.options))
+		body := countRequestBody(c.Request)
+		w := trackResponse(c)
+		var elapsedTime, firstByteTime time.Duration
+		mc.sink.requestStarted(c.Request.Context(), req)
+		defer func() {
+			// the context is read again, as the handlers, e.g. the tracing middleware, may have replaced it
+			res := requestResult{
+				status:          responseStatus(c),
+				duration:        elapsedTime,
+				timeToFirstByte: firstByteTime,
+				requestSize:     requestSize(c.Request, body),
+				responseSize:    responseSize(c),
+				panicked:        panicked(c),
+				errorTypes:      ginErrorTypes(c.Errors),
+			}
+			res.failed = failed(mc.options.statusMapper, res.status)
+			if objective, ok := mc.options.objective(req.route); ok {
+				res.objective = &objective
+				res.apdexZone, res.good = objective.evaluate(res.failed, res.duration)
+			}
+			mc.sink.requestFinished(c.Request.Context(), req, res)
+			mc.releaseCardinality(req)
+		}()
+
+		before := time.Now()
+		c.Next()
+		elapsedTime = time.Since(before)
+		firstByteTime = w.firstByteAt().Sub(before)
+	}
+}
+
+// limitCardinality replaces the label values of the request that exceed the cardinality limit.
+func (mc *MetricsCollector) limitCardinality(c *gin.Context, req requestInfo) requestInfo {
+	if mc.limiter == nil {
+		return req
+	}
+
+	var ok bool
+	if req.path != UnmatchedRoute {
+		if req.path, ok = mc.limiter.value(pathLabel, req.path); !ok {
+			mc.sink.labelOverflowed(c.Request.Context(), pathLabel)
+		}
+	}
+	for i, le := range mc.options.labelExtractors {
+		if req.labels[i], ok = mc.limiter.value(le.name, req.labels[i]); !ok {
+			mc.sink.labelOverflowed(c.Request.Context(), le.name)
+		}
+	}
+	return req
+}
+
+// releaseCardinality records that the label values of the request are no longer in flight.
+func (mc *MetricsCollector) releaseCardinality(req requestInfo) {
+	if mc.limiter == nil {
+		return
+	}
+
+	if req.path != UnmatchedRoute {
+		mc.limiter.done(pathLabel, req.path)
+	}
+	for i, le := range mc.options.labelExtractors {
+		mc.limiter.done(le.name, req.labels[i])
+	}
+}
+
+func newRequestInfo(c *gin.Context, opts metricsOptions) requestInfo {
+	labels := make([]string, len(opts.labelExtractors))
+	for i, le := range opts.labelExtractors {
+		labels[i] = le.extract(c)
+	}
+	return requestInfo{
+		path:            metricPath(c, opts.pathLabelMode),
+		route:           c.FullPath(),
+		method:          metricMethod(c.Request.Method),
+		scheme:          requestScheme(c.Request),
+		protocolVersion: protocolVersion(c.Request),
+		labels:          labels,
+	}
+}
+
+// metricPath returns the value of the http_path label for the request. The route template is
+// resolved by gin before the handler chain runs, so the value is stable for the whole request.
+func metricPath(c *gin.Context, mode PathLabelMode) string {
+	if mode == RawPathLabel {
+		return c.Request.URL.Path
+	}
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return UnmatchedRoute
+}
+
+// requestScheme returns the URL scheme of the request, i.e. `http` or `https`.
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return Https
+	}
+	return Http
+}
+
+// statusClass returns the class of the HTTP status code, e.g. `2xx`.
+func statusClass(status int) string {
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+// protocolVersion returns the HTTP version of the request, e.g. `1.1` or `2`.
+func protocolVersion(r *http.Request) string {
+	if r.ProtoMajor >= 2 {
+		return strconv.Itoa(r.ProtoMajor)
+	}
+	return fmt.Sprintf("%d.%d", r.ProtoMajor, r.ProtoMinor)
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return
+}
+
+// countRequestBody wraps the body of the request in a [countingReader] when its size is unknown,
+// i.e. when the Content-Length header is missing.
+func countRequestBody(r *http.Request) *countingReader {
+	if r.ContentLength >= 0 || r.Body == nil {
+		return nil
+	}
+	body := &countingReader{ReadCloser: r.Body}
+	r.Body = body
+	return body
+}
+
+// requestSize returns the Content-Length of the request, or the bytes read from its body when the
+// Content-Length is unknown.
+func requestSize(r *http.Request, body *countingReader) int64 {
+	if body != nil {
+		return body.n
+	}
+	return max(r.ContentLength, 0)
+}
+
+// responseSize returns the number of bytes written to the response body.
+func responseSize(c *gin.Context) int64 {
+	return int64(max(c.Writer.Size(), 0))
+}
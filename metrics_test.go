@@ -0,0 +1,592 @@
+package middleware_test
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	gonic "github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twistingmercury/middleware/v2"
+)
+
+func TestNewMetricsCollectorValidation(t *testing.T) {
+	testCases := []struct {
+		name     string
+		registry *prometheus.Registry
+		opts     []middleware.MetricsOption
+	}{
+		{"nil registry", nil, []middleware.MetricsOption{middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName)}},
+		{"empty namespace", prometheus.NewRegistry(), []middleware.MetricsOption{middleware.WithAPIName(serviceName)}},
+		{"empty api name", prometheus.NewRegistry(), []middleware.MetricsOption{middleware.WithNamespace(namespace)}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc, err := middleware.NewMetricsCollector(tc.registry, tc.opts...)
+			assert.Error(t, err)
+			assert.Nil(t, mc)
+		})
+	}
+}
+
+func TestMetricsCollectorsCoexist(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	public, err := middleware.NewMetricsCollector(registry, middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName))
+	require.NoError(t, err)
+	admin, err := middleware.NewMetricsCollector(registry, middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName))
+	require.NoError(t, err, "identical metrics should be reused")
+	other, err := middleware.NewMetricsCollector(prometheus.NewRegistry(), middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName))
+	require.NoError(t, err)
+
+	gonic.SetMode(gonic.TestMode)
+	for _, mc := range []*middleware.MetricsCollector{public, admin, other} {
+		r := gonic.New()
+		r.Use(mc.Middleware())
+		r.GET("/test", func(c *gonic.Context) {
+			c.Status(http.StatusOK)
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+	}
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, mf := range families {
+		if mf.GetName() == "unit_test_total_calls" {
+			require.Len(t, mf.GetMetric(), 1)
+			assert.Equal(t, float64(2), mf.GetMetric()[0].GetCounter().GetValue())
+		}
+	}
+}
+
+func TestNewMetricsCollectorConflictingLabels(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	_, err := middleware.NewMetricsCollector(registry, middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName))
+	require.NoError(t, err)
+
+	_, err = middleware.NewMetricsCollector(registry, middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName), middleware.WithStatusClassLabel())
+	assert.Error(t, err)
+}
+
+func TestPrometheusMetricsPathLabel(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mode     middleware.PathLabelMode
+		target   string
+		expected string
+	}{
+		{"route template", middleware.RoutePathLabel, "/users/42", "/users/:id"},
+		{"raw path", middleware.RawPathLabel, "/users/42", "/users/42"},
+		{"unmatched route", middleware.RoutePathLabel, "/missing/42", middleware.UnmatchedRoute},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			gonic.SetMode(gonic.TestMode)
+			r := gonic.New()
+			r.Use(middleware.PrometheusMetricsWithOptions(registry, namespace, serviceName, middleware.WithPathLabelMode(tc.mode)))
+			r.GET("/users/:id", func(c *gonic.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+			assert.Equal(t, []string{tc.expected}, labelValues(t, registry, "unit_test_total_calls", "http_path"))
+			assert.Equal(t, []string{tc.expected}, labelValues(t, registry, "unit_test_concurrent_calls", "http_path"))
+		})
+	}
+}
+
+func TestPrometheusMetricsExcludedPath(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(middleware.PrometheusMetrics(registry, namespace, serviceName, "/health"))
+	r.GET("/health", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	assert.Empty(t, labelValues(t, registry, "unit_test_total_calls", "http_path"))
+}
+
+func TestPrometheusMetricsStatusLabels(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(middleware.PrometheusMetricsWithOptions(registry, namespace, serviceName, middleware.WithStatusClassLabel()))
+	r.GET("/ok", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/fail", func(c *gonic.Context) {
+		c.Status(http.StatusServiceUnavailable)
+	})
+
+	for _, target := range []string{"/ok", "/fail", "/missing"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	for _, name := range []string{"unit_test_total_calls", "unit_test_call_duration"} {
+		assert.ElementsMatch(t, []string{"200", "503", "404"}, labelValues(t, registry, name, "http_status"))
+		assert.ElementsMatch(t, []string{"2xx", "5xx", "4xx"}, labelValues(t, registry, name, "http_status_class"))
+	}
+}
+
+func TestPrometheusMetricsWithoutStatusClassLabel(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(middleware.PrometheusMetrics(registry, namespace, serviceName))
+	r.GET("/ok", func(c *gonic.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ok", nil))
+
+	assert.Equal(t, []string{"201"}, labelValues(t, registry, "unit_test_total_calls", "http_status"))
+	assert.Empty(t, labelValues(t, registry, "unit_test_total_calls", "http_status_class"))
+}
+
+// labelValues returns the values of the given label for every series of the named metric.
+func labelValues(t *testing.T, registry *prometheus.Registry, metricName, label string) (values []string) {
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, mf := range families {
+		if mf.GetName() != metricName {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == label {
+					values = append(values, lp.GetValue())
+				}
+			}
+		}
+	}
+	return
+}
+
+func TestMetricsCollectorDurationBuckets(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opt      middleware.MetricsOption
+		expected []float64
+	}{
+		{"default", nil, middleware.DefaultLatencyProfile.Buckets()},
+		{"explicit", middleware.WithDurationBuckets(10, 100, 1000), []float64{10, 100, 1000}},
+		{"linear", middleware.WithLinearDurationBuckets(100, 100, 3), []float64{100, 200, 300}},
+		{"exponential", middleware.WithExponentialDurationBuckets(1, 10, 3), []float64{1, 10, 100}},
+		{"profile", middleware.WithLatencyProfile(middleware.SlowLatencyProfile), middleware.SlowLatencyProfile.Buckets()},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := []middleware.MetricsOption{middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName)}
+			if tc.opt != nil {
+				opts = append(opts, tc.opt)
+			}
+			registry := prometheus.NewRegistry()
+			serveTestRequest(t, registry, opts...)
+
+			var bounds []float64
+			for _, b := range gatherMetric(t, registry, "unit_test_call_duration").GetHistogram().GetBucket() {
+				bounds = append(bounds, b.GetUpperBound())
+			}
+			assert.Equal(t, tc.expected, bounds)
+		})
+	}
+}
+
+func TestMetricsCollectorNativeHistograms(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	serveTestRequest(t, registry,
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithNativeHistograms(1.1),
+		middleware.WithDurationBuckets())
+
+	h := gatherMetric(t, registry, "unit_test_call_duration").GetHistogram()
+	assert.Empty(t, h.GetBucket())
+	assert.NotZero(t, h.GetSchema())
+	assert.Equal(t, uint64(1), h.GetSampleCount())
+}
+
+func TestMetricsCollectorInvalidHistogramOptions(t *testing.T) {
+	_, err := middleware.NewMetricsCollector(prometheus.NewRegistry(),
+		middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName), middleware.WithNativeHistograms(0.5))
+	assert.Error(t, err)
+
+	_, err = middleware.NewMetricsCollector(prometheus.NewRegistry(),
+		middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName), middleware.WithDurationBuckets())
+	assert.Error(t, err)
+}
+
+func TestMetricsCollectorInvalidDurationBuckets(t *testing.T) {
+	testCases := []struct {
+		name string
+		opt  middleware.MetricsOption
+	}{
+		{"unsorted", middleware.WithDurationBuckets(100, 10)},
+		{"duplicate", middleware.WithDurationBuckets(10, 10)},
+		{"infinite", middleware.WithDurationBuckets(10, math.Inf(1))},
+		{"linear zero count", middleware.WithLinearDurationBuckets(1, 1, 0)},
+		{"linear zero width", middleware.WithLinearDurationBuckets(1, 0, 3)},
+		{"exponential zero count", middleware.WithExponentialDurationBuckets(1, 2, 0)},
+		{"exponential zero start", middleware.WithExponentialDurationBuckets(0, 2, 3)},
+		{"exponential factor of 1", middleware.WithExponentialDurationBuckets(1, 1, 3)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := middleware.NewMetricsCollector(prometheus.NewRegistry(),
+				middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName), tc.opt)
+			assert.Error(t, err)
+		})
+	}
+}
+
+// serveTestRequest serves a single GET request through a collector created with the options.
+func serveTestRequest(t *testing.T, registry *prometheus.Registry, opts ...middleware.MetricsOption) {
+	mc, err := middleware.NewMetricsCollector(registry, opts...)
+	require.NoError(t, err)
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware())
+	r.GET("/test", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+}
+
+// gatherMetric returns the first series of the named metric.
+func gatherMetric(t *testing.T, registry *prometheus.Registry, metricName string) *dto.Metric {
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, mf := range families {
+		if mf.GetName() == metricName {
+			require.NotEmpty(t, mf.GetMetric())
+			return mf.GetMetric()[0]
+		}
+	}
+	require.Failf(t, "metric not found", "metric %s was not gathered", metricName)
+	return nil
+}
+
+func TestMetricsCollectorSizes(t *testing.T) {
+	testCases := []struct {
+		name          string
+		contentLength int64
+		requestSize   float64
+	}{
+		{"content length", 11, 11},
+		{"unknown content length", -1, 11},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			mc, err := middleware.NewMetricsCollector(registry,
+				middleware.WithNamespace(namespace),
+				middleware.WithAPIName(serviceName),
+				middleware.WithRequestSizeBuckets(10, 100),
+				middleware.WithResponseSizeBuckets(1, 10))
+			require.NoError(t, err)
+
+			gonic.SetMode(gonic.TestMode)
+			r := gonic.New()
+			r.Use(mc.Middleware())
+			r.POST("/echo", func(c *gonic.Context) {
+				body, err := io.ReadAll(c.Request.Body)
+				require.NoError(t, err)
+				c.String(http.StatusOK, "%s", body[:5])
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("hello world"))
+			req.ContentLength = tc.contentLength
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			reqSize := gatherMetric(t, registry, "unit_test_request_size_bytes").GetHistogram()
+			assert.Equal(t, tc.requestSize, reqSize.GetSampleSum())
+			assert.Equal(t, []float64{10, 100}, []float64{reqSize.GetBucket()[0].GetUpperBound(), reqSize.GetBucket()[1].GetUpperBound()})
+
+			respSize := gatherMetric(t, registry, "unit_test_response_size_bytes").GetHistogram()
+			assert.Equal(t, float64(5), respSize.GetSampleSum())
+			assert.Equal(t, uint64(1), respSize.GetBucket()[1].GetCumulativeCount())
+		})
+	}
+}
+
+func TestMetricsCollectorInvalidSizeBuckets(t *testing.T) {
+	for _, opt := range []middleware.MetricsOption{
+		middleware.WithRequestSizeBuckets(1000, 100),
+		middleware.WithResponseSizeBuckets(100, math.NaN()),
+	} {
+		_, err := middleware.NewMetricsCollector(prometheus.NewRegistry(),
+			middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName), opt)
+		assert.Error(t, err)
+	}
+}
+
+func TestMetricsCollectorExemplars(t *testing.T) {
+	initializeTests(t)
+	defer resetTests()
+
+	registry := prometheus.NewRegistry()
+	mc, err := middleware.NewMetricsCollector(registry, middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName))
+	require.NoError(t, err)
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware(), middleware.OtelTracing())
+	r.GET("/test", func(c *gonic.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	for _, name := range []string{"unit_test_call_duration", "unit_test_request_size_bytes", "unit_test_response_size_bytes"} {
+		exemplar := histogramExemplar(t, registry, name)
+		require.NotNilf(t, exemplar, "no exemplar found for %s", name)
+
+		labels := make(map[string]string)
+		for _, lp := range exemplar.GetLabel() {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+		assert.Len(t, labels["trace_id"], 32)
+		assert.Len(t, labels["span_id"], 16)
+	}
+}
+
+func TestMetricsCollectorWithoutSpanHasNoExemplars(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	serveTestRequest(t, registry, middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName))
+
+	assert.Nil(t, histogramExemplar(t, registry, "unit_test_call_duration"))
+}
+
+// histogramExemplar returns the first exemplar found in the buckets of the named histogram.
+func histogramExemplar(t *testing.T, registry *prometheus.Registry, metricName string) *dto.Exemplar {
+	for _, b := range gatherMetric(t, registry, metricName).GetHistogram().GetBucket() {
+		if b.GetExemplar() != nil {
+			return b.GetExemplar()
+		}
+	}
+	return nil
+}
+
+func TestMetricsCollectorLabelExtractors(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	mc, err := middleware.NewMetricsCollector(registry,
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithLabelExtractor("Tenant-ID", middleware.HeaderLabel("X-Tenant-ID")),
+		middleware.WithLabelExtractor("client_app", middleware.ContextKeyLabel("client")))
+	require.NoError(t, err)
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(func(c *gonic.Context) { c.Set("client", "mobile") }, mc.Middleware())
+	r.GET("/test", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	for _, name := range []string{"unit_test_concurrent_calls", "unit_test_total_calls", "unit_test_call_duration", "unit_test_response_size_bytes"} {
+		assert.Equal(t, []string{"acme"}, labelValues(t, registry, name, "tenant_id"))
+		assert.Equal(t, []string{"mobile"}, labelValues(t, registry, name, "client_app"))
+	}
+}
+
+func TestMetricsCollectorInvalidLabelExtractors(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []middleware.MetricsOption
+	}{
+		{"nil extractor", []middleware.MetricsOption{middleware.WithLabelExtractor("tenant", nil)}},
+		{"invalid name", []middleware.MetricsOption{middleware.WithLabelExtractor("1tenant", middleware.HeaderLabel("X-Tenant"))}},
+		{"built-in name", []middleware.MetricsOption{middleware.WithLabelExtractor("http_path", middleware.HeaderLabel("X-Path"))}},
+		{"const label name", []middleware.MetricsOption{middleware.WithLabelExtractor("environment", middleware.HeaderLabel("X-Env"))}},
+		{"bucket label name", []middleware.MetricsOption{middleware.WithLabelExtractor("le", middleware.HeaderLabel("X-Le"))}},
+		{"quantile label name", []middleware.MetricsOption{
+			middleware.WithDurationSummary(nil, 0),
+			middleware.WithLabelExtractor("quantile", middleware.HeaderLabel("X-Quantile"))}},
+		{"duplicate name", []middleware.MetricsOption{
+			middleware.WithLabelExtractor("tenant", middleware.HeaderLabel("X-Tenant")),
+			middleware.WithLabelExtractor("Tenant", middleware.HeaderLabel("X-Tenant-ID"))}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]middleware.MetricsOption{middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName)}, tc.opts...)
+			_, err := middleware.NewMetricsCollector(prometheus.NewRegistry(), opts...)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMetricsCollectorCardinalityLimit(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	mc, err := middleware.NewMetricsCollector(registry,
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithPathLabelMode(middleware.RawPathLabel),
+		middleware.WithLabelExtractor("tenant", middleware.HeaderLabel("X-Tenant")),
+		middleware.WithCardinalityLimit(2))
+	require.NoError(t, err)
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware())
+	r.GET("/users/:id", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, id := range []string{"1", "2", "3", "1", "4"} {
+		req := httptest.NewRequest(http.MethodGet, "/users/"+id, nil)
+		req.Header.Set("X-Tenant", "acme")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+	}
+
+	assert.ElementsMatch(t, []string{"/users/1", "/users/2", middleware.OverflowLabelValue},
+		labelValues(t, registry, "unit_test_total_calls", "http_path"))
+	assert.Equal(t, []string{"acme", "acme", "acme"}, labelValues(t, registry, "unit_test_total_calls", "tenant"))
+
+	overflows := gatherMetric(t, registry, "unit_test_label_overflows_total")
+	assert.Equal(t, float64(2), overflows.GetCounter().GetValue())
+	assert.Equal(t, "http_path", overflows.GetLabel()[0].GetValue())
+}
+
+func TestMetricsCollectorUnknownMethod(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	mc, err := middleware.NewMetricsCollector(registry, middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName))
+	require.NoError(t, err)
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware())
+	r.Handle("PURGE", "/cache", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PURGE", "/cache", nil))
+
+	assert.Equal(t, []string{middleware.OtherMethod}, labelValues(t, registry, "unit_test_total_calls", "http_method"))
+}
+
+func TestMetricsCollectorTimeToFirstByte(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	mc, err := middleware.NewMetricsCollector(registry, middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName))
+	require.NoError(t, err)
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware())
+	r.GET("/stream", func(c *gonic.Context) {
+		c.String(http.StatusOK, "first")
+		c.Writer.Flush()
+		time.Sleep(20 * time.Millisecond)
+		c.String(http.StatusOK, "second")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+	ttfb := gatherMetric(t, registry, "unit_test_time_to_first_byte").GetHistogram()
+	duration := gatherMetric(t, registry, "unit_test_call_duration").GetHistogram()
+	require.Equal(t, uint64(1), ttfb.GetSampleCount())
+	assert.Less(t, ttfb.GetSampleSum(), float64(20))
+	assert.GreaterOrEqual(t, duration.GetSampleSum(), float64(20))
+}
+
+func TestMetricsCollectorDurationSummary(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	serveTestRequest(t, registry,
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithDurationSummary(nil, time.Minute))
+
+	summary := gatherMetric(t, registry, "unit_test_call_duration").GetSummary()
+	require.NotNil(t, summary)
+	assert.Equal(t, uint64(1), summary.GetSampleCount())
+
+	var quantiles []float64
+	for _, q := range summary.GetQuantile() {
+		quantiles = append(quantiles, q.GetQuantile())
+	}
+	assert.Equal(t, []float64{0.5, 0.9, 0.99}, quantiles)
+}
+
+func TestMetricsCollectorInvalidSummaryObjectives(t *testing.T) {
+	_, err := middleware.NewMetricsCollector(prometheus.NewRegistry(),
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithDurationSummary(map[float64]float64{1.5: 0.01}, 0))
+	assert.Error(t, err)
+}
+
+func TestMetricsCollectorConstLabels(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	serveTestRequest(t, registry,
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithServiceVersion("1.2.3-canary"),
+		middleware.WithEnvironment("staging"))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	require.NotEmpty(t, families)
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			assert.Equal(t, "1.2.3-canary", labels["service_version"], mf.GetName())
+			assert.Equal(t, "staging", labels["environment"], mf.GetName())
+		}
+	}
+}
+
+func TestMetricsCollectorBuildInfo(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	_, err := middleware.NewMetricsCollector(registry,
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithBuildInfo())
+	require.NoError(t, err)
+
+	assert.Equal(t, float64(1), gatherMetric(t, registry, "unit_test_build_info").GetGauge().GetValue())
+	assert.Equal(t, []string{runtime.Version()}, labelValues(t, registry, "unit_test_build_info", "go_version"))
+}
+
+func TestDeprecatedMetrics(t *testing.T) {
+	concurrentCalls, totalCalls, callDuration := middleware.Metrics()
+	require.NotNil(t, concurrentCalls)
+	require.NotNil(t, totalCalls)
+	require.NotNil(t, callDuration)
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(totalCalls), "the vectors should not be registered already")
+	assert.NotPanics(t, func() { callDuration.WithLabelValues("/test", http.MethodGet, "200").Observe(12) })
+}
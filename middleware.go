@@ -3,28 +3,24 @@ package middleware
 import (
 	"errors"
 	"fmt"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/twistingmercury/telemetry/v2/logging"
 	"github.com/twistingmercury/telemetry/v2/tracing"
+	"net"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mileusna/useragent"
 
+	"go.opentelemetry.io/otel/attribute"
 	otelCodes "go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
 	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
-const ( // for metric vectors
-	methodLabel = "http_method"
-	statusLabel = "http_status"
-	pathLabel   = "http_path"
-)
-
 const ( // for user agent properties and values
 	UserAgentOS             = "http.user_agent.os"
 	UserAgentOSVersion      = "http.user_agent.os_version"
@@ -43,143 +39,166 @@ const ( // for user agent properties and values
 	DeviceBot               = "bot"
 )
 
+const ( // for span events
+	FirstByteEvent = "http.response.first_byte"
+)
+
 const ( // for http request properties and header values
-	Http            = "http"
-	Https           = "https"
-	HttpMethod      = "http.request.method"
-	HttpPath        = "http.request.path"
-	HttpRemoteAddr  = "http.request.remoteAddr"
-	HttpRequestHost = "http.request.host"
-	HttpStatus      = "http.response.status"
-	HttpLatency     = "http.response.latency"
-	TLSVersion      = "http.tls.serviceVersion"
-	HttpScheme      = "http.scheme"
+	Http                = "http"
+	Https               = "https"
+	HttpMethod          = "http.request.method"
+	HttpPath            = "http.request.path"
+	HttpRemoteAddr      = "http.request.remoteAddr"
+	HttpRequestHost     = "http.request.host"
+	HttpStatus          = "http.response.status"
+	HttpLatency         = "http.response.latency"
+	HttpTimeToFirstByte = "http.response.ttfb"
+	TLSVersion          = "http.tls.serviceVersion"
+	HttpScheme          = "http.scheme"
+
+	HttpClientDisconnected = "http.request.client_disconnected"
 
 	//QueryString = "http.request.queryString"
 ) //
 
-var (
-	reg             *prometheus.Registry
-	totalCalls      *prometheus.CounterVec
-	concurrentCalls *prometheus.GaugeVec
-	callDuration    *prometheus.HistogramVec
-	apiName         string
-	nspace          string
-)
-
 // Logging returns the logging middleware
 func Logging(excludePaths ...string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		path := c.Request.URL.Path
-
-		if containsPath(excludePaths, path) {
-			c.Next()
-			return
-		}
-		var elapsedTime float64
-
-		before := time.Now()
-		c.Next()
-		elapsedTime = float64(time.Since(before)) / float64(time.Millisecond)
-
-		logRequest(c, elapsedTime)
-	}
+	return LoggingWithOptions(WithExcludedPaths(excludePaths...))
 }
 
-// PrometheusMetrics returns the metrics middleware used by the Prometheus software.
-func PrometheusMetrics(registry *prometheus.Registry, namespace string, apiname string, excludePaths ...string) gin.HandlerFunc {
-	switch {
-	case registry == nil:
-		panic("registry is nil")
-	case strings.TrimSpace(namespace) == "":
-		panic("namespace is empty")
-	case strings.TrimSpace(apiname) == "":
-		panic("apiname is empty")
-	}
-
-	reg = registry
-	nspace = namespace
-	apiName = apiname
-
-	concurrentCalls, totalCalls, callDuration = Metrics()
-	reg.MustRegister(concurrentCalls, totalCalls, callDuration)
-
+// LoggingWithOptions returns the logging middleware, configured by the provided [LoggingOption] values.
+func LoggingWithOptions(opts ...LoggingOption) gin.HandlerFunc {
+	options := newLoggingOptions(opts...)
 	return func(c *gin.Context) {
-		path := c.Request.URL.Path
-
-		if containsPath(excludePaths, path) {
+		if skipRequest(c, options.excludePaths) {
 			c.Next()
 			return
 		}
-
-		method := c.Request.Method
-		var elapsedTime float64
-		var statusCode string
-		concurrentCalls.WithLabelValues(path, method).Inc()
-		defer func() {
-			concurrentCalls.WithLabelValues(path, method).Dec()
-			callDuration.WithLabelValues(path, method, statusCode).Observe(elapsedTime)
-			totalCalls.WithLabelValues(path, method, statusCode).Inc()
-		}()
+		var elapsedTime, firstByteTime float64
+		w := trackResponse(c)
 
 		before := time.Now()
 		c.Next()
 		elapsedTime = float64(time.Since(before)) / float64(time.Millisecond)
-	}
-}
+		firstByteTime = float64(w.firstByteAt().Sub(before)) / float64(time.Millisecond)
 
-// Metrics provides the prometheus metrics that are to be tracked.
-func Metrics() (*prometheus.GaugeVec, *prometheus.CounterVec, *prometheus.HistogramVec) {
-	concurrentCallsName := normalize(fmt.Sprintf("%s_concurrent_calls", apiName))
-	concurrentCalls := prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: nspace,
-		Name:      concurrentCallsName,
-		Help:      "the count of concurrent calls to the APIs, grouped by path and http method"},
-		[]string{pathLabel, methodLabel})
-
-	totalCallsName := normalize(fmt.Sprintf("%s_total_calls", apiName))
-	totalCalls := prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: nspace,
-		Name:      totalCallsName,
-		Help:      "The count of all call to the API, grouped by path, http method, and status code"},
-		[]string{pathLabel, methodLabel, statusLabel})
-
-	callDurationName := normalize(fmt.Sprintf("%s_call_duration", apiName))
-	callDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Namespace: nspace,
-		Name:      callDurationName,
-		Help:      "The duration in milliseconds calls to the API, grouped by path, http method, and status code",
-		Buckets:   prometheus.ExponentialBuckets(0.1, 1.5, 5)},
-		[]string{pathLabel, methodLabel, statusLabel})
-
-	return concurrentCalls, totalCalls, callDuration
+		logRequest(c, options.statusMapper, elapsedTime, firstByteTime)
+	}
 }
 
 // OtelTracing returns the tracing middleware.
 func OtelTracing(excludePaths ...string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		path := c.Request.URL.Path
+	return OtelTracingWithOptions(WithExcludedPaths(excludePaths...))
+}
 
-		if containsPath(excludePaths, path) {
+// OtelTracingWithOptions returns the tracing middleware, configured by the provided [TracingOption] values.
+func OtelTracingWithOptions(opts ...TracingOption) gin.HandlerFunc {
+	options := newTracingOptions(opts...)
+	return func(c *gin.Context) {
+		if skipRequest(c, options.excludePaths) {
 			c.Next()
 			return
 		}
 
-		spanName := fmt.Sprintf("%s: %s", c.Request.Method, c.Request.URL.Path)
+		spanName := options.spanNameFormatter(c)
 		parentCtx := tracing.ExtractContext(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
-		childCtx, span := tracing.Start(parentCtx, spanName, oteltrace.SpanKindServer, semconv.HTTPRoute(spanName))
+		// the attributes are set on the span rather than passed to tracing.Start, which would add
+		// them to the attributes of every span started afterward
+		childCtx, span := tracing.Start(parentCtx, spanName, oteltrace.SpanKindServer)
+		span.SetAttributes(serverSpanAttributes(c)...)
 		c.Request = c.Request.WithContext(childCtx)
 		defer span.End()
+		w := trackResponse(c)
+		start := time.Now()
+		w.onBeforeWrite(func() { writeResponseHeaders(c, options, span, start) })
 
 		c.Next()
 
-		code, desc := SpanStatus(c.Writer.Status())
+		if !c.Writer.Written() {
+			w.runBeforeWrite()
+		}
+		status := responseStatus(c)
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		span.AddEvent(FirstByteEvent, oteltrace.WithTimestamp(w.firstByteAt()))
+		if clientDisconnected(c) {
+			span.SetAttributes(attribute.Bool(HttpClientDisconnected, true))
+		}
+		recordGinErrors(span, c.Errors, options.errorStackTraces)
+		code, desc := options.statusMapper.SpanStatus(status)
+		if code == otelCodes.Error {
+			span.SetAttributes(semconv.ErrorTypeKey.String(strconv.Itoa(status)))
+		}
 		span.SetStatus(code, desc)
 	}
 }
 
+// DefaultSpanName returns the name of the span of a request following the semantic conventions,
+// i.e. `{method} {route}`, e.g. `GET /users/:id`, or only the method when the request does not match
+// a route. Unknown methods are named `HTTP`.
+func DefaultSpanName(c *gin.Context) string {
+	method := c.Request.Method
+	if metricMethod(method) == OtherMethod {
+		method = "HTTP"
+	}
+	if route := c.FullPath(); route != "" {
+		return method + " " + route
+	}
+	return method
+}
+
+// serverSpanAttributes returns the semantic convention attributes of the HTTP server span of the
+// request that are known before it is handled.
+func serverSpanAttributes(c *gin.Context) []attribute.KeyValue {
+	r := c.Request
+	scheme := requestScheme(r)
+	method := metricMethod(r.Method)
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(method),
+		semconv.URLPath(r.URL.Path),
+		semconv.URLScheme(scheme),
+		semconv.NetworkProtocolVersion(protocolVersion(r)),
+	}
+	if method != r.Method {
+		attrs = append(attrs, semconv.HTTPRequestMethodOriginal(r.Method))
+	}
+	if route := c.FullPath(); route != "" {
+		attrs = append(attrs, semconv.HTTPRoute(route))
+	}
+	if host, port := serverHostPort(r.Host, scheme); host != "" {
+		attrs = append(attrs, semconv.ServerAddress(host))
+		if port > 0 {
+			attrs = append(attrs, semconv.ServerPort(port))
+		}
+	}
+	if ip := c.ClientIP(); ip != "" {
+		attrs = append(attrs, semconv.ClientAddress(ip))
+	}
+	if ua := r.UserAgent(); ua != "" {
+		attrs = append(attrs, semconv.UserAgentOriginal(ua))
+	}
+	return attrs
+}
+
+// serverHostPort splits the Host header of a request into the server address and port. The port
+// defaults to the one of the scheme when the header has none.
+func serverHostPort(hostport, scheme string) (host string, port int) {
+	host, portText, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+		if scheme == Https {
+			return host, 443
+		}
+		return host, 80
+	}
+	port, _ = strconv.Atoi(portText)
+	return host, port
+}
+
 // SpanStatus returns the OpenTelemetry statusLabel code as defined in
 // go.opentelemetry.io/old_elemetry/codes and a brief description for a given HTTP statusLabel code.
+//
+// Deprecated: the tracing middleware uses a [StatusMapper]; use [DefaultStatusMapper], which
+// follows the OpenTelemetry guidance for HTTP server spans.
 func SpanStatus(status int) (code otelCodes.Code, desc string) {
 	switch {
 	case status >= 200 && status < 300:
@@ -216,7 +235,7 @@ func SpanStatus(status int) (code otelCodes.Code, desc string) {
 	return
 }
 
-func logRequest(c *gin.Context, elapsedTime float64) {
+func logRequest(c *gin.Context, mapper StatusMapper, elapsedTime, firstByteTime float64) {
 	ctx := c.Request.Context()
 	defer func() {
 		if r := recover(); r != nil {
@@ -225,13 +244,14 @@ func logRequest(c *gin.Context, elapsedTime float64) {
 		}
 	}()
 
-	status := c.Writer.Status()
+	status := responseStatus(c)
 	args := map[string]any{
-		HttpMethod:     c.Request.Method,
-		HttpPath:       c.Request.URL.Path,
-		HttpRemoteAddr: c.Request.RemoteAddr,
-		HttpStatus:     status,
-		HttpLatency:    fmt.Sprintf("%fms", elapsedTime),
+		HttpMethod:          c.Request.Method,
+		HttpPath:            c.Request.URL.Path,
+		HttpRemoteAddr:      c.Request.RemoteAddr,
+		HttpStatus:          status,
+		HttpLatency:         fmt.Sprintf("%fms", elapsedTime),
+		HttpTimeToFirstByte: fmt.Sprintf("%fms", firstByteTime),
 	}
 
 	scheme := Http
@@ -254,10 +274,23 @@ func logRequest(c *gin.Context, elapsedTime float64) {
 	ua := ParseUserAgent(c.Request.UserAgent())
 	args = logging.MergeMaps(args, ua)
 
+	if status == StatusClientClosedRequest {
+		args[HttpClientDisconnected] = true
+		logging.Warn(ctx, "request aborted by client", fromMap(args)...)
+		return
+	}
+
+	if len(c.Errors) > 0 {
+		args[GinErrors] = ginErrorEntries(c.Errors)
+	}
+
 	logAttribs := fromMap(args)
-	if status > 499 || c.Errors.Last() != nil {
-		errs := strings.Join(c.Errors.Errors(), ";")
-		logging.Error(ctx, errors.New(errs), "request failed", logAttribs...)
+	if failed(mapper, status) || c.Errors.Last() != nil {
+		errs := make([]error, len(c.Errors))
+		for i, err := range c.Errors {
+			errs[i] = err
+		}
+		logging.Error(ctx, errors.Join(errs...), "request failed", logAttribs...)
 		return
 	}
 
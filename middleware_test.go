@@ -201,6 +201,9 @@ func checkLog(t *testing.T, expectedLogLevel string, expectTracingAttrs bool) {
 		require.NotContains(t, logEntry, "otel.span_id")
 	}
 
+	require.Contains(t, logEntry, middleware.HttpLatency)
+	require.Contains(t, logEntry, middleware.HttpTimeToFirstByte)
+
 	require.Equal(t, expectedLogLevel, logEntry["level"])
 	require.Equal(t, serviceName, logEntry["service"])
 	require.Equal(t, serviceVersion, logEntry["version"])
@@ -0,0 +1,677 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// PathLabelMode determines the value used for the http_path label of the metrics.
+type PathLabelMode int
+
+const (
+	// RoutePathLabel labels the metrics with the matched gin route template, e.g. `/users/:id`.
+	// Requests that do not match a route are labeled with [UnmatchedRoute]. This is the default.
+	RoutePathLabel PathLabelMode = iota
+
+	// RawPathLabel labels the metrics with the raw request URL path, e.g. `/users/42`.
+	// Every distinct path creates a new series, so only use this for APIs without path parameters.
+	RawPathLabel
+)
+
+// UnmatchedRoute is the http_path label value used for requests that did not match any route, e.g. 404s.
+const UnmatchedRoute = "unmatched"
+
+// LatencyProfile is a preset of duration histogram buckets, in milliseconds, suited to the typical
+// latency of an API.
+type LatencyProfile int
+
+const (
+	// DefaultLatencyProfile suits APIs that typically respond within tens to hundreds of milliseconds.
+	// Its buckets range from 5ms to 10s. This is the default.
+	DefaultLatencyProfile LatencyProfile = iota
+
+	// FastLatencyProfile suits APIs that typically respond within a few milliseconds, e.g. caches.
+	// Its buckets range from 0.5ms to 1s.
+	FastLatencyProfile
+
+	// SlowLatencyProfile suits APIs that typically respond within seconds, e.g. reports or batch jobs.
+	// Its buckets range from 100ms to 2m.
+	SlowLatencyProfile
+)
+
+// Buckets returns the upper bounds, in milliseconds, of the duration histogram buckets of the profile.
+func (p LatencyProfile) Buckets() []float64 {
+	switch p {
+	case FastLatencyProfile:
+		return []float64{0.5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000}
+	case SlowLatencyProfile:
+		return []float64{100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000, 120000}
+	default:
+		return []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+	}
+}
+
+// DefaultSizeBuckets returns the default upper bounds, in bytes, of the buckets of the request and
+// response size histograms. They range from 100B to 100MB.
+func DefaultSizeBuckets() []float64 {
+	return prometheus.ExponentialBuckets(100, 10, 7)
+}
+
+// DefaultSummaryObjectives returns the default quantiles of the call duration summary, mapped to
+// their absolute error: the 50th, 90th and 99th percentiles.
+func DefaultSummaryObjectives() map[float64]float64 {
+	return map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+}
+
+// Option configures several middlewares, so it can be passed to each of them.
+type Option interface {
+	MetricsOption
+	TracingOption
+	LoggingOption
+}
+
+// MetricsOption configures the metrics middleware.
+type MetricsOption interface {
+	applyMetrics(*metricsOptions)
+}
+
+type metricsOptionFunc func(*metricsOptions)
+
+func (f metricsOptionFunc) applyMetrics(opts *metricsOptions) {
+	f(opts)
+}
+
+type metricsOptions struct {
+	namespace          string
+	apiName            string
+	excludePaths       []string
+	pathLabelMode      PathLabelMode
+	statusClassLabel   bool
+	durationBuckets    []float64
+	durationBucketsErr error // the invalid arguments of the linear or exponential duration buckets
+
+	requestSizeBuckets  []float64
+	responseSizeBuckets []float64
+
+	nativeHistogramBucketFactor float64
+
+	durationSummary   bool
+	summaryObjectives map[float64]float64
+	summaryMaxAge     time.Duration
+
+	labelExtractors  []labelExtractor
+	cardinalityLimit int
+
+	statsdFormat        StatsDFormat
+	statsdFlushInterval time.Duration
+	statsdMaxPacketSize int
+
+	pushURL      string
+	pushJob      string
+	pushInterval time.Duration
+	pushGrouping map[string]string
+
+	routeObjectives  map[string]Objective
+	defaultObjective *Objective
+
+	seriesTTL time.Duration
+
+	serviceVersion string
+	environment    string
+	buildInfo      bool
+
+	statusMapper StatusMapper
+}
+
+// LabelExtractor returns the value of a custom metric label for a request.
+type LabelExtractor func(c *gin.Context) string
+
+type labelExtractor struct {
+	name    string
+	extract LabelExtractor
+}
+
+// validate returns an error if the options are not valid for any metrics backend.
+func (o metricsOptions) validate() error {
+	// the bucket and quantile labels are reserved by the histograms and summaries
+	names := map[string]bool{pathLabel: true, methodLabel: true, statusLabel: true, statusClassLabel: true, errorTypeLabel: true, apdexZoneLabel: true,
+		serviceVersionLabel: true, environmentLabel: true, model.BucketLabel: true, model.QuantileLabel: true}
+	if o.cardinalityLimit < 0 {
+		return errors.New("cardinality limit must not be negative")
+	}
+	if o.durationBucketsErr != nil {
+		return o.durationBucketsErr
+	}
+	for route, objective := range o.routeObjectives {
+		if err := objective.validate(); err != nil {
+			return fmt.Errorf("invalid objective for route %q: %w", route, err)
+		}
+	}
+	if o.defaultObjective != nil {
+		if err := o.defaultObjective.validate(); err != nil {
+			return fmt.Errorf("invalid default objective: %w", err)
+		}
+	}
+	for _, le := range o.labelExtractors {
+		switch {
+		case le.extract == nil:
+			return fmt.Errorf("label extractor for %q is nil", le.name)
+		case !model.LabelName(le.name).IsValid():
+			return fmt.Errorf("invalid label name %q", le.name)
+		case names[le.name]:
+			return fmt.Errorf("duplicate label name %q", le.name)
+		}
+		names[le.name] = true
+	}
+	return nil
+}
+
+// labelNames returns the names of the custom labels, in the order of the extractors.
+func (o metricsOptions) labelNames() []string {
+	names := make([]string, len(o.labelExtractors))
+	for i, le := range o.labelExtractors {
+		names[i] = le.name
+	}
+	return names
+}
+
+func newMetricsOptions(opts ...MetricsOption) metricsOptions {
+	o := metricsOptions{
+		pathLabelMode:   RoutePathLabel,
+		durationBuckets: DefaultLatencyProfile.Buckets(),
+
+		requestSizeBuckets:  DefaultSizeBuckets(),
+		responseSizeBuckets: DefaultSizeBuckets(),
+
+		statsdFlushInterval: defaultStatsDFlushInterval,
+		statsdMaxPacketSize: defaultStatsDMaxPacketSize,
+
+		statusMapper: DefaultStatusMapper(),
+	}
+	for _, opt := range opts {
+		opt.applyMetrics(&o)
+	}
+	return o
+}
+
+// WithNamespace sets the namespace of the metrics. It is required.
+func WithNamespace(namespace string) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.namespace = namespace
+	})
+}
+
+// WithAPIName sets the name of the API, which prefixes the name of each metric. It is required.
+func WithAPIName(apiName string) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.apiName = apiName
+	})
+}
+
+// WithLabelExtractor adds a label to all the metrics of the collector, whose value is returned by
+// the extractor. The name is normalized, e.g. `Tenant-ID` becomes `tenant_id`, and must not collide
+// with the name of another label, nor be `le` or `quantile`, which are reserved. The extractor is invoked before the request is handled, so
+// values stored in [gin.Context.Keys] must be set by middleware registered before the metrics
+// middleware.
+func WithLabelExtractor(name string, extractor LabelExtractor) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.labelExtractors = append(opts.labelExtractors, labelExtractor{name: normalize(name), extract: extractor})
+	})
+}
+
+// HeaderLabel returns a [LabelExtractor] that reads the value of the request header.
+func HeaderLabel(header string) LabelExtractor {
+	return func(c *gin.Context) string {
+		return c.GetHeader(header)
+	}
+}
+
+// ContextKeyLabel returns a [LabelExtractor] that reads the string value stored in the
+// [gin.Context] for the key.
+func ContextKeyLabel(key string) LabelExtractor {
+	return func(c *gin.Context) string {
+		return c.GetString(key)
+	}
+}
+
+// WithExcludedPaths prevents requests to the given URL paths from being recorded, traced or logged.
+func WithExcludedPaths(paths ...string) Option {
+	return excludedPathsOption(paths)
+}
+
+type excludedPathsOption []string
+
+func (o excludedPathsOption) applyMetrics(opts *metricsOptions) {
+	opts.excludePaths = append(opts.excludePaths, o...)
+}
+
+func (o excludedPathsOption) applyTracing(opts *tracingOptions) {
+	opts.excludePaths = append(opts.excludePaths, o...)
+}
+
+func (o excludedPathsOption) applyLogging(opts *loggingOptions) {
+	opts.excludePaths = append(opts.excludePaths, o...)
+}
+
+// WithStatusMapper sets how the status codes of the responses are mapped to span statuses, which
+// also determines the requests logged as failed and counted against the objectives of the routes.
+// The default is [DefaultStatusMapper] without additional error codes.
+func WithStatusMapper(mapper StatusMapper) Option {
+	return statusMapperOption{mapper: mapper}
+}
+
+type statusMapperOption struct {
+	mapper StatusMapper
+}
+
+func (o statusMapperOption) applyMetrics(opts *metricsOptions) {
+	if o.mapper != nil {
+		opts.statusMapper = o.mapper
+	}
+}
+
+func (o statusMapperOption) applyTracing(opts *tracingOptions) {
+	if o.mapper != nil {
+		opts.statusMapper = o.mapper
+	}
+}
+
+func (o statusMapperOption) applyLogging(opts *loggingOptions) {
+	if o.mapper != nil {
+		opts.statusMapper = o.mapper
+	}
+}
+
+// WithPathLabelMode sets how the http_path label is populated. The default is [RoutePathLabel].
+func WithPathLabelMode(mode PathLabelMode) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.pathLabelMode = mode
+	})
+}
+
+// WithStatusClassLabel adds the http_status_class label (2xx, 3xx, 4xx, 5xx) to the metrics that
+// are grouped by status code, so they can be aggregated without a regular expression.
+func WithStatusClassLabel() MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.statusClassLabel = true
+	})
+}
+
+// WithDurationBuckets sets the upper bounds, in milliseconds, of the buckets of the call duration
+// histogram. The bounds must be finite and strictly increasing. Calling it without buckets
+// disables the classic buckets, which is only valid together with [WithNativeHistograms].
+func WithDurationBuckets(buckets ...float64) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.durationBuckets = buckets
+		opts.durationBucketsErr = nil
+	})
+}
+
+// WithLinearDurationBuckets sets count buckets of the call duration histogram, each width
+// milliseconds wide, where the lowest bucket has an upper bound of start milliseconds.
+// The count must be at least 1, and the width greater than 0.
+func WithLinearDurationBuckets(start, width float64, count int) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		switch {
+		case count < 1:
+			opts.durationBucketsErr = fmt.Errorf("linear duration bucket count %d must be at least 1", count)
+		case width <= 0:
+			opts.durationBucketsErr = fmt.Errorf("linear duration bucket width %v must be greater than 0", width)
+		default:
+			opts.durationBuckets = prometheus.LinearBuckets(start, width, count)
+			opts.durationBucketsErr = nil
+		}
+	})
+}
+
+// WithExponentialDurationBuckets sets count buckets of the call duration histogram, where the
+// lowest bucket has an upper bound of start milliseconds and each following bucket's upper bound
+// is factor times the previous one. The count must be at least 1, the start greater than 0, and
+// the factor greater than 1.
+func WithExponentialDurationBuckets(start, factor float64, count int) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		switch {
+		case count < 1:
+			opts.durationBucketsErr = fmt.Errorf("exponential duration bucket count %d must be at least 1", count)
+		case start <= 0:
+			opts.durationBucketsErr = fmt.Errorf("exponential duration bucket start %v must be greater than 0", start)
+		case factor <= 1:
+			opts.durationBucketsErr = fmt.Errorf("exponential duration bucket factor %v must be greater than 1", factor)
+		default:
+			opts.durationBuckets = prometheus.ExponentialBuckets(start, factor, count)
+			opts.durationBucketsErr = nil
+		}
+	})
+}
+
+// WithLatencyProfile sets the buckets of the call duration histogram to those of the profile.
+func WithLatencyProfile(profile LatencyProfile) MetricsOption {
+	return WithDurationBuckets(profile.Buckets()...)
+}
+
+// WithNativeHistograms enables Prometheus native histograms for the histograms of the collector.
+// The bucketFactor must be greater than 1; the smaller it is, the higher the resolution, e.g. 1.1
+// keeps the relative error of the percentiles below 5%. The classic buckets are still exposed
+// unless they are disabled by calling [WithDurationBuckets] without buckets.
+func WithNativeHistograms(bucketFactor float64) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.nativeHistogramBucketFactor = bucketFactor
+	})
+}
+
+// WithRequestSizeBuckets sets the upper bounds, in bytes, of the buckets of the request size histogram.
+// The bounds must be finite and strictly increasing.
+func WithRequestSizeBuckets(buckets ...float64) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.requestSizeBuckets = buckets
+	})
+}
+
+// WithResponseSizeBuckets sets the upper bounds, in bytes, of the buckets of the response size histogram.
+// The bounds must be finite and strictly increasing.
+func WithResponseSizeBuckets(buckets ...float64) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.responseSizeBuckets = buckets
+	})
+}
+
+// WithCardinalityLimit caps the number of distinct values of the http_path label and of each custom
+// label at limit. Once a label has reached its limit, new values are recorded as
+// [OverflowLabelValue] and counted by the label overflows metric. [UnmatchedRoute] does not count
+// toward the limit. Independently of this option, HTTP methods that are not standard are always
+// recorded as [OtherMethod]. With [WithSeriesTTL], the values not recorded for the TTL free their
+// slots, as their series expire; otherwise, the values count toward the limit for the lifetime of
+// the collector.
+func WithCardinalityLimit(limit int) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.cardinalityLimit = limit
+	})
+}
+
+// WithDurationSummary records the call duration as a Prometheus summary instead of a histogram, so
+// the quantiles are computed in process. The objectives map the quantiles to their absolute error;
+// when nil, [DefaultSummaryObjectives] are used. The quantiles are computed over a sliding window
+// of maxAge; when zero, the window is 10 minutes. Summaries cannot be aggregated across instances,
+// and this option is ignored by the OpenTelemetry backend.
+func WithDurationSummary(objectives map[float64]float64, maxAge time.Duration) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		if objectives == nil {
+			objectives = DefaultSummaryObjectives()
+		}
+		opts.durationSummary = true
+		opts.summaryObjectives = objectives
+		opts.summaryMaxAge = maxAge
+	})
+}
+
+// WithStatsDFormat sets the line format used by the StatsD backend. The default is [StatsDTags].
+func WithStatsDFormat(format StatsDFormat) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.statsdFormat = format
+	})
+}
+
+// WithStatsDFlushInterval sets how often the StatsD backend sends the buffered metrics. The default
+// is one second.
+func WithStatsDFlushInterval(interval time.Duration) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.statsdFlushInterval = interval
+	})
+}
+
+// WithStatsDMaxPacketSize sets the maximum size in bytes of the packets sent by the StatsD backend.
+// The default is 1432 bytes, which fits a network with a 1500 bytes MTU; use 8932 for jumbo frames.
+func WithStatsDMaxPacketSize(size int) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.statsdMaxPacketSize = size
+	})
+}
+
+// WithPushgateway pushes the metrics of the registry of the collector to the Prometheus Pushgateway
+// at the URL, under the job, every interval and once more when the collector is closed, see
+// [MetricsCollector.Close]. Use it for short-lived services that may exit before they are scraped.
+// It applies to the Prometheus backend only, and requires a collector created with
+// [NewMetricsCollector] and closed on shutdown; [PrometheusMetricsWithOptions] panics if it is used.
+func WithPushgateway(url, job string, interval time.Duration) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.pushURL = url
+		opts.pushJob = job
+		opts.pushInterval = interval
+	})
+}
+
+// WithPushGrouping adds labels to the grouping key of the metrics pushed to the Pushgateway, e.g. the
+// instance, so several instances of the job do not overwrite each other's metrics.
+func WithPushGrouping(labels map[string]string) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		if opts.pushGrouping == nil {
+			opts.pushGrouping = make(map[string]string)
+		}
+		for name, value := range labels {
+			opts.pushGrouping[name] = value
+		}
+	})
+}
+
+// WithRouteObjective sets the service level objective of the gin route template, e.g. `/users/:id`.
+// The requests to the route are counted by Apdex zone, and as good and total events of the SLO.
+func WithRouteObjective(route string, objective Objective) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		if opts.routeObjectives == nil {
+			opts.routeObjectives = make(map[string]Objective)
+		}
+		opts.routeObjectives[route] = objective
+	})
+}
+
+// WithDefaultObjective sets the service level objective of the routes that have none set with
+// [WithRouteObjective]. Requests that do not match a route have no objective.
+func WithDefaultObjective(objective Objective) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.defaultObjective = &objective
+	})
+}
+
+// WithSeriesTTL deletes the metric series, i.e. the label value combinations, that have not been
+// recorded for the TTL, so label values that are no longer used, e.g. the paths of a one-off scan
+// or retired tenants, stop being exported. A deleted series starts from zero when it is recorded
+// again. The series of requests in flight are kept. The expired values no longer count toward the
+// cardinality limit, see [WithCardinalityLimit]. The metrics of the collector cannot be shared
+// with another collector of the same registry until it is closed, as the series of the requests in
+// flight of the other collector would be deleted. It applies to the Prometheus backend only, and
+// requires a collector created with [NewMetricsCollector] and closed on shutdown;
+// [PrometheusMetricsWithOptions] panics if it is used.
+func WithSeriesTTL(ttl time.Duration) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.seriesTTL = ttl
+	})
+}
+
+// WithServiceVersion adds the service_version const label, set to the version, to all the metrics,
+// e.g. to compare a canary with the stable deployment. It applies to the Prometheus backend only.
+func WithServiceVersion(version string) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.serviceVersion = version
+	})
+}
+
+// WithEnvironment adds the environment const label, set to the environment, to all the metrics.
+// It applies to the Prometheus backend only.
+func WithEnvironment(environment string) MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.environment = environment
+	})
+}
+
+// WithBuildInfo registers the <apiname>_build_info gauge, whose labels are the module path, module
+// version, VCS revision and Go version read from the build information of the binary, see
+// [runtime/debug.ReadBuildInfo]. It applies to the Prometheus backend only.
+func WithBuildInfo() MetricsOption {
+	return metricsOptionFunc(func(opts *metricsOptions) {
+		opts.buildInfo = true
+	})
+}
+
+// TracingOption configures the tracing middleware, see [OtelTracingWithOptions].
+type TracingOption interface {
+	applyTracing(*tracingOptions)
+}
+
+type tracingOptionFunc func(*tracingOptions)
+
+func (f tracingOptionFunc) applyTracing(opts *tracingOptions) {
+	f(opts)
+}
+
+type tracingOptions struct {
+	excludePaths      []string
+	spanNameFormatter SpanNameFormatter
+	statusMapper      StatusMapper
+	errorStackTraces  bool
+
+	traceResponseHeader bool
+	traceIDHeader       string
+	serverTiming        bool
+}
+
+func newTracingOptions(opts ...TracingOption) tracingOptions {
+	o := tracingOptions{spanNameFormatter: DefaultSpanName, statusMapper: DefaultStatusMapper()}
+	for _, opt := range opts {
+		opt.applyTracing(&o)
+	}
+	return o
+}
+
+// SpanNameFormatter returns the name of the span of a request.
+type SpanNameFormatter func(c *gin.Context) string
+
+// WithSpanNameFormatter sets the formatter of the span names. The default is [DefaultSpanName].
+func WithSpanNameFormatter(formatter SpanNameFormatter) TracingOption {
+	return tracingOptionFunc(func(opts *tracingOptions) {
+		if formatter != nil {
+			opts.spanNameFormatter = formatter
+		}
+	})
+}
+
+// WithErrorStackTraces records the stack trace of the gin errors that carry one, e.g. created with
+// github.com/pkg/errors, in the exception.stacktrace attribute of their exception events.
+func WithErrorStackTraces() TracingOption {
+	return tracingOptionFunc(func(opts *tracingOptions) {
+		opts.errorStackTraces = true
+	})
+}
+
+// WithTraceResponseHeader writes the traceresponse header, as drafted by the W3C Trace Context
+// specification, e.g. `00-{trace-id}-{span-id}-01`, to the responses, so a failing request can be
+// connected to its trace.
+func WithTraceResponseHeader() TracingOption {
+	return tracingOptionFunc(func(opts *tracingOptions) {
+		opts.traceResponseHeader = true
+	})
+}
+
+// WithTraceIDHeader writes the trace id of the requests to the responses in the header, or in the
+// [TraceIDHeader] header if it is empty.
+func WithTraceIDHeader(header string) TracingOption {
+	return tracingOptionFunc(func(opts *tracingOptions) {
+		if header == "" {
+			header = TraceIDHeader
+		}
+		opts.traceIDHeader = header
+	})
+}
+
+// WithServerTiming writes the Server-Timing header to the responses, with the duration of the
+// handlers until the response is written as the total metric, followed by the timings registered
+// with [AddServerTiming].
+func WithServerTiming() TracingOption {
+	return tracingOptionFunc(func(opts *tracingOptions) {
+		opts.serverTiming = true
+	})
+}
+
+// LoggingOption configures the logging middleware, see [LoggingWithOptions].
+type LoggingOption interface {
+	applyLogging(*loggingOptions)
+}
+
+type loggingOptions struct {
+	excludePaths []string
+	statusMapper StatusMapper
+}
+
+func newLoggingOptions(opts ...LoggingOption) loggingOptions {
+	o := loggingOptions{statusMapper: DefaultStatusMapper()}
+	for _, opt := range opts {
+		opt.applyLogging(&o)
+	}
+	return o
+}
+
+// EndpointOption configures the metrics endpoint mounted by [MountMetrics].
+type EndpointOption interface {
+	applyEndpoint(*endpointOptions)
+}
+
+type endpointOptionFunc func(*endpointOptions)
+
+func (f endpointOptionFunc) applyEndpoint(opts *endpointOptions) {
+	f(opts)
+}
+
+type endpointOptions struct {
+	path               string
+	basicAuth          bool
+	username, password string
+	bearerAuth         bool
+	bearerToken        string
+	disableCompression bool
+}
+
+func newEndpointOptions(opts ...EndpointOption) endpointOptions {
+	options := endpointOptions{path: DefaultMetricsPath}
+	for _, opt := range opts {
+		opt.applyEndpoint(&options)
+	}
+	return options
+}
+
+// WithMetricsPath sets the path of the metrics endpoint. It defaults to [DefaultMetricsPath].
+func WithMetricsPath(path string) EndpointOption {
+	return endpointOptionFunc(func(opts *endpointOptions) {
+		opts.path = path
+	})
+}
+
+// WithBasicAuth protects the metrics endpoint with HTTP basic authentication. The username and
+// password must not be empty.
+func WithBasicAuth(username, password string) EndpointOption {
+	return endpointOptionFunc(func(opts *endpointOptions) {
+		opts.basicAuth = true
+		opts.username = username
+		opts.password = password
+	})
+}
+
+// WithBearerToken protects the metrics endpoint with a bearer token, sent by the scraper in the
+// Authorization header. The token must not be empty.
+func WithBearerToken(token string) EndpointOption {
+	return endpointOptionFunc(func(opts *endpointOptions) {
+		opts.bearerAuth = true
+		opts.bearerToken = token
+	})
+}
+
+// WithoutCompression disables the gzip compression of the metrics, which is otherwise used when
+// the scraper accepts it.
+func WithoutCompression() EndpointOption {
+	return endpointOptionFunc(func(opts *endpointOptions) {
+		opts.disableCompression = true
+	})
+}
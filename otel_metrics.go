@@ -0,0 +1,260 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// instrumentationName is the name of the OpenTelemetry instrumentation scope of the package.
+const instrumentationName = "github.com/twistingmercury/middleware/v2"
+
+// ginErrorTypeAttribute is the attribute holding the type of a gin error, see [ginErrorType].
+const ginErrorTypeAttribute = "gin.error.type"
+
+const ( // for the metrics that are not part of the semantic conventions
+	timeToFirstByteName = "http.server.time_to_first_byte"
+	labelOverflowsName  = "http.server.attribute.overflows"
+	panicsName          = "http.server.panics"
+	ginErrorsName       = "http.server.gin.errors"
+	apdexName           = "http.server.apdex"
+	sloEventsName       = "http.server.slo.events"
+	sloGoodEventsName   = "http.server.slo.good_events"
+	sloObjectiveName    = "http.server.slo.objective"
+)
+
+// apdexZoneAttribute is the attribute holding the Apdex zone of a request, see [Objective].
+const apdexZoneAttribute = "apdex.zone"
+
+// otelSink records the metrics of a [MetricsCollector] using the OpenTelemetry metrics API, following
+// the semantic conventions for HTTP servers.
+type otelSink struct {
+	labelNames      []string
+	activeRequests  metric.Int64UpDownCounter
+	requestDuration metric.Float64Histogram
+	timeToFirstByte metric.Float64Histogram
+	requestSize     metric.Int64Histogram
+	responseSize    metric.Int64Histogram
+	labelOverflows  metric.Int64Counter
+	panics          metric.Int64Counter
+	ginErrors       metric.Int64Counter
+	apdex           metric.Int64Counter
+	sloEvents       metric.Int64Counter
+	sloGoodEvents   metric.Int64Counter
+	sloObjective    metric.Float64Gauge
+}
+
+// NewOtelMetricsCollector creates a [MetricsCollector] that records the OpenTelemetry semantic
+// convention metrics for HTTP servers using the meters of the provider:
+//   - http.server.request.duration
+//   - http.server.active_requests
+//   - http.server.request.body.size
+//   - http.server.response.body.size
+//
+// The namespace and API name are not used; the bucket options are applied as explicit bucket
+// boundary advice, with the duration buckets converted from milliseconds to seconds.
+func NewOtelMetricsCollector(provider metric.MeterProvider, opts ...MetricsOption) (*MetricsCollector, error) {
+	options := newMetricsOptions(opts...)
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	sink, err := newOtelSink(provider, options)
+	if err != nil {
+		return nil, err
+	}
+	return newMetricsCollector(options, sink), nil
+}
+
+func newOtelSink(provider metric.MeterProvider, options metricsOptions) (sink *otelSink, err error) {
+	if provider == nil {
+		return nil, errors.New("meter provider is nil")
+	}
+
+	meter := provider.Meter(instrumentationName)
+	sink = &otelSink{labelNames: options.labelNames()}
+
+	sink.activeRequests, err = meter.Int64UpDownCounter(
+		semconv.HTTPServerActiveRequestsName,
+		metric.WithUnit(semconv.HTTPServerActiveRequestsUnit),
+		metric.WithDescription(semconv.HTTPServerActiveRequestsDescription))
+	if err != nil {
+		return nil, err
+	}
+
+	durationBuckets := make([]float64, len(options.durationBuckets))
+	for i, b := range options.durationBuckets {
+		durationBuckets[i] = b / 1000
+	}
+	sink.requestDuration, err = meter.Float64Histogram(
+		semconv.HTTPServerRequestDurationName,
+		metric.WithUnit(semconv.HTTPServerRequestDurationUnit),
+		metric.WithDescription(semconv.HTTPServerRequestDurationDescription),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+
+	sink.timeToFirstByte, err = meter.Float64Histogram(
+		timeToFirstByteName,
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration until the first byte of the HTTP server response is written."),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+
+	sink.requestSize, err = meter.Int64Histogram(
+		semconv.HTTPServerRequestBodySizeName,
+		metric.WithUnit(semconv.HTTPServerRequestBodySizeUnit),
+		metric.WithDescription(semconv.HTTPServerRequestBodySizeDescription),
+		metric.WithExplicitBucketBoundaries(options.requestSizeBuckets...))
+	if err != nil {
+		return nil, err
+	}
+
+	sink.responseSize, err = meter.Int64Histogram(
+		semconv.HTTPServerResponseBodySizeName,
+		metric.WithUnit(semconv.HTTPServerResponseBodySizeUnit),
+		metric.WithDescription(semconv.HTTPServerResponseBodySizeDescription),
+		metric.WithExplicitBucketBoundaries(options.responseSizeBuckets...))
+	if err != nil {
+		return nil, err
+	}
+
+	sink.labelOverflows, err = meter.Int64Counter(
+		labelOverflowsName,
+		metric.WithUnit("{request}"),
+		metric.WithDescription("The count of requests whose attribute value was replaced because the attribute reached its cardinality limit."))
+	if err != nil {
+		return nil, err
+	}
+
+	sink.panics, err = meter.Int64Counter(
+		panicsName,
+		metric.WithUnit("{request}"),
+		metric.WithDescription("The count of HTTP server requests whose handlers panicked."))
+	if err != nil {
+		return nil, err
+	}
+
+	sink.ginErrors, err = meter.Int64Counter(
+		ginErrorsName,
+		metric.WithUnit("{error}"),
+		metric.WithDescription("The count of errors attached to the gin context by the HTTP server handlers."))
+	if err != nil {
+		return nil, err
+	}
+
+	sink.apdex, err = meter.Int64Counter(
+		apdexName,
+		metric.WithUnit("{request}"),
+		metric.WithDescription("The count of HTTP server requests to routes with an objective, by Apdex zone."))
+	if err != nil {
+		return nil, err
+	}
+
+	sink.sloEvents, err = meter.Int64Counter(
+		sloEventsName,
+		metric.WithUnit("{request}"),
+		metric.WithDescription("The count of HTTP server requests to routes with an objective."))
+	if err != nil {
+		return nil, err
+	}
+
+	sink.sloGoodEvents, err = meter.Int64Counter(
+		sloGoodEventsName,
+		metric.WithUnit("{request}"),
+		metric.WithDescription("The count of HTTP server requests to routes with an objective that met its latency without a server error."))
+	if err != nil {
+		return nil, err
+	}
+
+	sink.sloObjective, err = meter.Float64Gauge(
+		sloObjectiveName,
+		metric.WithUnit("1"),
+		metric.WithDescription("The availability objective of the HTTP server routes, i.e. the target ratio of good events."))
+	if err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (sink *otelSink) requestStarted(ctx context.Context, req requestInfo) {
+	sink.activeRequests.Add(ctx, 1, metric.WithAttributeSet(sink.activeRequestAttributes(req)))
+}
+
+func (sink *otelSink) requestFinished(ctx context.Context, req requestInfo, res requestResult) {
+	sink.activeRequests.Add(ctx, -1, metric.WithAttributeSet(sink.activeRequestAttributes(req)))
+
+	attrs := metric.WithAttributeSet(sink.requestAttributes(req, res))
+	sink.requestDuration.Record(ctx, res.duration.Seconds(), attrs)
+	sink.timeToFirstByte.Record(ctx, res.timeToFirstByte.Seconds(), attrs)
+	sink.requestSize.Record(ctx, res.requestSize, attrs)
+	sink.responseSize.Record(ctx, res.responseSize, attrs)
+	if res.panicked {
+		sink.panics.Add(ctx, 1, metric.WithAttributeSet(sink.activeRequestAttributes(req)))
+	}
+	for _, errorType := range res.errorTypes {
+		attrs := []attribute.KeyValue{attribute.String(ginErrorTypeAttribute, errorType)}
+		if req.route != "" {
+			attrs = append(attrs, semconv.HTTPRoute(req.route))
+		}
+		sink.ginErrors.Add(ctx, 1, metric.WithAttributes(sink.appendLabels(attrs, req)...))
+	}
+	if res.objective != nil {
+		route := semconv.HTTPRoute(req.route)
+		sink.apdex.Add(ctx, 1, metric.WithAttributes(
+			sink.appendLabels([]attribute.KeyValue{route, attribute.String(apdexZoneAttribute, res.apdexZone)}, req)...))
+		events := metric.WithAttributes(sink.appendLabels([]attribute.KeyValue{route}, req)...)
+		sink.sloEvents.Add(ctx, 1, events)
+		var good int64
+		if res.good {
+			good = 1
+		}
+		// a zero is added to create the data point of the route before its first good event
+		sink.sloGoodEvents.Add(ctx, good, events)
+		sink.sloObjective.Record(ctx, res.objective.Availability, metric.WithAttributes(route))
+	}
+}
+
+// activeRequestAttributes returns the attributes of the http.server.active_requests metric.
+func (sink *otelSink) activeRequestAttributes(req requestInfo) attribute.Set {
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(req.method),
+		semconv.URLScheme(req.scheme),
+	}
+	return attribute.NewSet(sink.appendLabels(attrs, req)...)
+}
+
+// requestAttributes returns the attributes of the metrics recorded once a request is handled.
+func (sink *otelSink) requestAttributes(req requestInfo, res requestResult) attribute.Set {
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(req.method),
+		semconv.URLScheme(req.scheme),
+		semconv.HTTPResponseStatusCode(res.status),
+		semconv.NetworkProtocolVersion(req.protocolVersion),
+	}
+	if req.route != "" {
+		attrs = append(attrs, semconv.HTTPRoute(req.route))
+	}
+	if res.failed {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(strconv.Itoa(res.status)))
+	}
+	return attribute.NewSet(sink.appendLabels(attrs, req)...)
+}
+
+func (sink *otelSink) labelOverflowed(ctx context.Context, label string) {
+	sink.labelOverflows.Add(ctx, 1, metric.WithAttributes(attribute.String(overflowLabel, label)))
+}
+
+// appendLabels appends the custom labels of the request as attributes.
+func (sink *otelSink) appendLabels(attrs []attribute.KeyValue, req requestInfo) []attribute.KeyValue {
+	for i, name := range sink.labelNames {
+		attrs = append(attrs, attribute.String(name, req.labels[i]))
+	}
+	return attrs
+}
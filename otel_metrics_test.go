@@ -0,0 +1,84 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gonic "github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twistingmercury/middleware/v2"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestNewOtelMetricsCollectorWithNilProvider(t *testing.T) {
+	mc, err := middleware.NewOtelMetricsCollector(nil)
+	assert.Error(t, err)
+	assert.Nil(t, mc)
+}
+
+func TestOtelMetricsCollector(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	mc, err := middleware.NewOtelMetricsCollector(provider, middleware.WithLabelExtractor("tenant", middleware.HeaderLabel("X-Tenant")))
+	require.NoError(t, err)
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware())
+	r.POST("/users/:id", func(c *gonic.Context) {
+		c.String(http.StatusInternalServerError, "failed")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/users/42", strings.NewReader("hello"))
+	req.Header.Set("X-Tenant", "acme")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	metrics := make(map[string]metricdata.Metrics)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+
+	duration, ok := metrics["http.server.request.duration"].Data.(metricdata.Histogram[float64])
+	require.True(t, ok)
+	require.Len(t, duration.DataPoints, 1)
+	attrs := duration.DataPoints[0].Attributes
+	assertAttribute(t, attrs, "http.request.method", attribute.StringValue(http.MethodPost))
+	assertAttribute(t, attrs, "http.route", attribute.StringValue("/users/:id"))
+	assertAttribute(t, attrs, "http.response.status_code", attribute.IntValue(http.StatusInternalServerError))
+	assertAttribute(t, attrs, "url.scheme", attribute.StringValue("http"))
+	assertAttribute(t, attrs, "network.protocol.version", attribute.StringValue("1.1"))
+	assertAttribute(t, attrs, "error.type", attribute.StringValue("500"))
+	assertAttribute(t, attrs, "tenant", attribute.StringValue("acme"))
+	assert.Equal(t, 0.005, duration.DataPoints[0].Bounds[0], "duration buckets should be in seconds")
+
+	active, ok := metrics["http.server.active_requests"].Data.(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, active.DataPoints, 1)
+	assert.Equal(t, int64(0), active.DataPoints[0].Value)
+
+	reqSize, ok := metrics["http.server.request.body.size"].Data.(metricdata.Histogram[int64])
+	require.True(t, ok)
+	assert.Equal(t, int64(5), reqSize.DataPoints[0].Sum)
+
+	respSize, ok := metrics["http.server.response.body.size"].Data.(metricdata.Histogram[int64])
+	require.True(t, ok)
+	assert.Equal(t, int64(6), respSize.DataPoints[0].Sum)
+}
+
+func assertAttribute(t *testing.T, attrs attribute.Set, key attribute.Key, expected attribute.Value) {
+	actual, ok := attrs.Value(key)
+	if assert.Truef(t, ok, "attribute %s not found", key) {
+		assert.Equal(t, expected, actual)
+	}
+}
@@ -0,0 +1,465 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const ( // for native histograms
+	nativeHistogramMaxBuckets       = 160
+	nativeHistogramMinResetDuration = time.Hour
+)
+
+const ( // for metric vectors
+	methodLabel = "http_method"
+	statusLabel = "http_status"
+	pathLabel   = "http_path"
+
+	statusClassLabel = "http_status_class"
+
+	overflowLabel  = "label"
+	errorTypeLabel = "error_type"
+	apdexZoneLabel = "apdex_zone"
+)
+
+const ( // for exemplars
+	traceIDExemplar = "trace_id"
+	spanIDExemplar  = "span_id"
+)
+
+// prometheusSink records the metrics of a [MetricsCollector] in a Prometheus registry.
+type prometheusSink struct {
+	registry        *prometheus.Registry
+	options         metricsOptions
+	concurrentCalls *prometheus.GaugeVec
+	totalCalls      *prometheus.CounterVec
+	callDuration    prometheus.ObserverVec // a histogram, or a summary, see [WithDurationSummary]
+	timeToFirstByte *prometheus.HistogramVec
+	requestSize     *prometheus.HistogramVec
+	responseSize    *prometheus.HistogramVec
+	labelOverflows  *prometheus.CounterVec
+	panics          *prometheus.CounterVec
+	ginErrors       *prometheus.CounterVec
+	buildInfo       *prometheus.GaugeVec
+	apdex           *prometheus.CounterVec
+	sloEvents       *prometheus.CounterVec
+	sloGoodEvents   *prometheus.CounterVec
+	sloObjective    *prometheus.GaugeVec
+	pushgateway     *pushgateway
+	janitor         *seriesJanitor         // nil unless the series expire, see [WithSeriesTTL]
+	expiring        []prometheus.Collector // the collectors registered with expiring series
+}
+
+func newPrometheusSink(registry *prometheus.Registry, options metricsOptions) (*prometheusSink, error) {
+	switch {
+	case registry == nil:
+		return nil, errors.New("registry is nil")
+	case strings.TrimSpace(options.namespace) == "":
+		return nil, errors.New("namespace is empty")
+	case strings.TrimSpace(options.apiName) == "":
+		return nil, errors.New("apiname is empty")
+	case options.nativeHistogramBucketFactor != 0 && options.nativeHistogramBucketFactor <= 1:
+		return nil, errors.New("native histogram bucket factor must be greater than 1")
+	case options.nativeHistogramBucketFactor == 0 &&
+		(len(options.durationBuckets) == 0 || len(options.requestSizeBuckets) == 0 || len(options.responseSizeBuckets) == 0):
+		return nil, errors.New("histogram buckets are empty and native histograms are disabled")
+	case options.summaryMaxAge < 0:
+		return nil, errors.New("summary max age must not be negative")
+	case options.seriesTTL < 0:
+		return nil, errors.New("series ttl must not be negative")
+	case options.pushURL != "" && strings.TrimSpace(options.pushJob) == "":
+		return nil, errors.New("pushgateway job is empty")
+	case options.pushURL != "" && options.pushInterval <= 0:
+		return nil, errors.New("pushgateway interval must be greater than 0")
+	}
+	if err := validateBuckets("duration", options.durationBuckets); err != nil {
+		return nil, err
+	}
+	if err := validateBuckets("request size", options.requestSizeBuckets); err != nil {
+		return nil, err
+	}
+	if err := validateBuckets("response size", options.responseSizeBuckets); err != nil {
+		return nil, err
+	}
+	for quantile := range options.summaryObjectives {
+		if quantile <= 0 || quantile >= 1 {
+			return nil, fmt.Errorf("summary objective quantile %v must be between 0 and 1", quantile)
+		}
+	}
+
+	ps := &prometheusSink{registry: registry, options: options}
+	if options.pushURL != "" {
+		pg, err := newPushgateway(registry, options)
+		if err != nil {
+			return nil, err
+		}
+		ps.pushgateway = pg
+	}
+	if err := ps.registerMetrics(); err != nil {
+		ps.releaseCollectors()
+		return nil, err
+	}
+	if ps.pushgateway != nil {
+		ps.pushgateway.start()
+	}
+	if options.seriesTTL > 0 {
+		ps.janitor = newSeriesJanitor(options.seriesTTL)
+	}
+	return ps, nil
+}
+
+// Close stops the expiry of the series, so the metrics can be shared again, and pushes the metrics
+// to the Pushgateway one last time, if enabled.
+func (ps *prometheusSink) Close() error {
+	if ps.janitor != nil {
+		ps.janitor.Close()
+		ps.releaseCollectors()
+	}
+	if ps.pushgateway == nil {
+		return nil
+	}
+	return ps.pushgateway.Close()
+}
+
+// releaseCollectors lets the collectors registered by the sink be shared again, once their series
+// no longer expire.
+func (ps *prometheusSink) releaseCollectors() {
+	for _, c := range ps.expiring {
+		expiringCollectors.Delete(c)
+	}
+	ps.expiring = nil
+}
+
+func (ps *prometheusSink) requestStarted(_ context.Context, req requestInfo) {
+	labels := append([]string{req.path, req.method}, req.labels...)
+	ps.track(ps.concurrentCalls, 1, labels...)
+	ps.concurrentCalls.WithLabelValues(labels...).Inc()
+}
+
+func (ps *prometheusSink) requestFinished(ctx context.Context, req requestInfo, res requestResult) {
+	labels := []string{req.path, req.method, strconv.Itoa(res.status)}
+	if ps.options.statusClassLabel {
+		labels = append(labels, statusClass(res.status))
+	}
+	labels = append(labels, req.labels...)
+	methodLabels := append([]string{req.path, req.method}, req.labels...)
+	pathLabels := append([]string{req.path}, req.labels...)
+
+	exemplar := traceExemplar(ctx)
+	ps.track(ps.concurrentCalls, -1, methodLabels...)
+	ps.concurrentCalls.WithLabelValues(methodLabels...).Dec()
+	ps.track(ps.callDuration.(labelDeleter), 0, labels...)
+	observe(ps.callDuration.WithLabelValues(labels...), float64(res.duration)/float64(time.Millisecond), exemplar)
+	ps.track(ps.timeToFirstByte, 0, labels...)
+	observe(ps.timeToFirstByte.WithLabelValues(labels...), float64(res.timeToFirstByte)/float64(time.Millisecond), exemplar)
+	ps.track(ps.totalCalls, 0, labels...)
+	ps.totalCalls.WithLabelValues(labels...).Inc()
+	ps.track(ps.requestSize, 0, labels...)
+	observe(ps.requestSize.WithLabelValues(labels...), float64(res.requestSize), exemplar)
+	ps.track(ps.responseSize, 0, labels...)
+	observe(ps.responseSize.WithLabelValues(labels...), float64(res.responseSize), exemplar)
+	if res.panicked {
+		ps.track(ps.panics, 0, methodLabels...)
+		ps.panics.WithLabelValues(methodLabels...).Inc()
+	}
+	for _, errorType := range res.errorTypes {
+		errorLabels := append([]string{req.path, errorType}, req.labels...)
+		ps.track(ps.ginErrors, 0, errorLabels...)
+		ps.ginErrors.WithLabelValues(errorLabels...).Inc()
+	}
+	if res.objective != nil {
+		apdexLabels := append([]string{req.path, res.apdexZone}, req.labels...)
+		ps.track(ps.apdex, 0, apdexLabels...)
+		ps.apdex.WithLabelValues(apdexLabels...).Inc()
+		ps.track(ps.sloEvents, 0, pathLabels...)
+		ps.sloEvents.WithLabelValues(pathLabels...).Inc()
+		// the good events series is created along with the events series, so that the ratio of
+		// both is defined before the first good event
+		ps.track(ps.sloGoodEvents, 0, pathLabels...)
+		good := ps.sloGoodEvents.WithLabelValues(pathLabels...)
+		if res.good {
+			good.Inc()
+		} else {
+			good.Add(0)
+		}
+		ps.track(ps.sloObjective, 0, req.path)
+		ps.sloObjective.WithLabelValues(req.path).Set(res.objective.Availability)
+	}
+}
+
+// track records that the series of the vector is used, when the series expire. The delta changes
+// the requests in flight of the series.
+func (ps *prometheusSink) track(vec labelDeleter, delta int, values ...string) {
+	if ps.janitor != nil {
+		ps.janitor.touch(vec, delta, values...)
+	}
+}
+
+func (ps *prometheusSink) labelOverflowed(_ context.Context, label string) {
+	ps.labelOverflows.WithLabelValues(label).Inc()
+}
+
+// validateBuckets returns an error if the bucket bounds of the histogram are not finite and
+// strictly increasing. The histograms are created when they are first recorded, so the bounds are
+// checked upfront rather than panicking in the middleware.
+func validateBuckets(histogram string, buckets []float64) error {
+	for i, b := range buckets {
+		switch {
+		case math.IsNaN(b) || math.IsInf(b, 0):
+			return fmt.Errorf("%s histogram bucket %v is not finite", histogram, b)
+		case i > 0 && b <= buckets[i-1]:
+			return fmt.Errorf("%s histogram buckets must be strictly increasing, %v follows %v", histogram, b, buckets[i-1])
+		}
+	}
+	return nil
+}
+
+// traceExemplar returns the exemplar labels identifying the span of the context, or nil if the
+// span is not sampled. Exemplars are only exposed when the metrics are scraped in the OpenMetrics format.
+func traceExemplar(ctx context.Context) prometheus.Labels {
+	sc := oteltrace.SpanContextFromContext(ctx)
+	if !sc.IsSampled() {
+		return nil
+	}
+	return prometheus.Labels{
+		traceIDExemplar: sc.TraceID().String(),
+		spanIDExemplar:  sc.SpanID().String(),
+	}
+}
+
+// observe records the value, along with the exemplar if there is one.
+func observe(observer prometheus.Observer, value float64, exemplar prometheus.Labels) {
+	if eo, ok := observer.(prometheus.ExemplarObserver); ok && exemplar != nil {
+		eo.ObserveWithExemplar(value, exemplar)
+		return
+	}
+	observer.Observe(value)
+}
+
+// registerMetrics creates the metric vectors of the sink and registers them.
+func (ps *prometheusSink) registerMetrics() (err error) {
+	statusLabels := []string{pathLabel, methodLabel, statusLabel}
+	if ps.options.statusClassLabel {
+		statusLabels = append(statusLabels, statusClassLabel)
+	}
+	statusLabels = append(statusLabels, ps.options.labelNames()...)
+
+	ps.concurrentCalls, err = register(ps, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   ps.options.namespace,
+		ConstLabels: ps.constLabels(),
+		Name:        ps.metricName("concurrent_calls"),
+		Help:        "the count of concurrent calls to the APIs, grouped by path and http method"},
+		append([]string{pathLabel, methodLabel}, ps.options.labelNames()...)))
+	if err != nil {
+		return
+	}
+
+	ps.totalCalls, err = register(ps, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   ps.options.namespace,
+		ConstLabels: ps.constLabels(),
+		Name:        ps.metricName("total_calls"),
+		Help:        "The count of all call to the API, grouped by path, http method, and status code"},
+		statusLabels))
+	if err != nil {
+		return
+	}
+
+	if ps.options.durationSummary {
+		ps.callDuration, err = register(ps, prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace:   ps.options.namespace,
+			ConstLabels: ps.constLabels(),
+			Name:        ps.metricName("call_duration"),
+			Help:        "The duration in milliseconds calls to the API, grouped by path, http method, and status code",
+			Objectives:  ps.options.summaryObjectives,
+			MaxAge:      ps.options.summaryMaxAge},
+			statusLabels))
+	} else {
+		ps.callDuration, err = register(ps, prometheus.NewHistogramVec(ps.histogramOpts(
+			"call_duration",
+			"The duration in milliseconds calls to the API, grouped by path, http method, and status code",
+			ps.options.durationBuckets),
+			statusLabels))
+	}
+	if err != nil {
+		return
+	}
+
+	ps.timeToFirstByte, err = register(ps, prometheus.NewHistogramVec(ps.histogramOpts(
+		"time_to_first_byte",
+		"The duration in milliseconds until the first byte of the response is written, grouped by path, http method, and status code",
+		ps.options.durationBuckets),
+		statusLabels))
+	if err != nil {
+		return
+	}
+
+	ps.requestSize, err = register(ps, prometheus.NewHistogramVec(ps.histogramOpts(
+		"request_size_bytes",
+		"The size in bytes of the request bodies received by the API, grouped by path, http method, and status code",
+		ps.options.requestSizeBuckets),
+		statusLabels))
+	if err != nil {
+		return
+	}
+
+	ps.responseSize, err = register(ps, prometheus.NewHistogramVec(ps.histogramOpts(
+		"response_size_bytes",
+		"The size in bytes of the response bodies sent by the API, grouped by path, http method, and status code",
+		ps.options.responseSizeBuckets),
+		statusLabels))
+	if err != nil {
+		return
+	}
+
+	ps.labelOverflows, err = register(ps, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   ps.options.namespace,
+		ConstLabels: ps.constLabels(),
+		Name:        ps.metricName("label_overflows_total"),
+		Help:        "The count of calls to the API whose label value was replaced because the label reached its cardinality limit, grouped by label"},
+		[]string{overflowLabel}))
+	if err != nil {
+		return
+	}
+
+	ps.panics, err = register(ps, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   ps.options.namespace,
+		ConstLabels: ps.constLabels(),
+		Name:        ps.metricName("panics_total"),
+		Help:        "The count of calls to the API whose handlers panicked, grouped by path and http method"},
+		append([]string{pathLabel, methodLabel}, ps.options.labelNames()...)))
+	if err != nil {
+		return
+	}
+
+	ps.ginErrors, err = register(ps, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   ps.options.namespace,
+		ConstLabels: ps.constLabels(),
+		Name:        ps.metricName("gin_errors_total"),
+		Help:        "The count of errors attached to the gin context by the handlers of the API, grouped by path and gin error type"},
+		append([]string{pathLabel, errorTypeLabel}, ps.options.labelNames()...)))
+	if err != nil {
+		return
+	}
+
+	ps.apdex, err = register(ps, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   ps.options.namespace,
+		ConstLabels: ps.constLabels(),
+		Name:        ps.metricName("apdex_total"),
+		Help:        "The count of calls to the API routes with an objective, grouped by path and Apdex zone (satisfied, tolerating or frustrated)"},
+		append([]string{pathLabel, apdexZoneLabel}, ps.options.labelNames()...)))
+	if err != nil {
+		return
+	}
+
+	ps.sloEvents, err = register(ps, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   ps.options.namespace,
+		ConstLabels: ps.constLabels(),
+		Name:        ps.metricName("slo_events_total"),
+		Help:        "The count of calls to the API routes with an objective, grouped by path"},
+		append([]string{pathLabel}, ps.options.labelNames()...)))
+	if err != nil {
+		return
+	}
+
+	ps.sloGoodEvents, err = register(ps, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   ps.options.namespace,
+		ConstLabels: ps.constLabels(),
+		Name:        ps.metricName("slo_good_events_total"),
+		Help:        "The count of calls to the API routes with an objective that met its latency without a server error, grouped by path"},
+		append([]string{pathLabel}, ps.options.labelNames()...)))
+	if err != nil {
+		return
+	}
+
+	ps.sloObjective, err = register(ps, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   ps.options.namespace,
+		ConstLabels: ps.constLabels(),
+		Name:        ps.metricName("slo_objective_ratio"),
+		Help:        "The availability objective of the API routes, i.e. the target ratio of good events, grouped by path"},
+		[]string{pathLabel}))
+	if err != nil || !ps.options.buildInfo {
+		return
+	}
+
+	info := buildInfo()
+	ps.buildInfo, err = register(ps, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   ps.options.namespace,
+		ConstLabels: ps.constLabels(),
+		Name:        ps.metricName("build_info"),
+		Help:        "A metric with a constant '1' value labeled by the module path, module version, VCS revision, and Go version the API was built from"},
+		[]string{modulePathLabel, moduleVersionLabel, vcsRevisionLabel, goVersionLabel}))
+	if err != nil {
+		return
+	}
+	ps.buildInfo.WithLabelValues(info[modulePathLabel], info[moduleVersionLabel], info[vcsRevisionLabel], info[goVersionLabel]).Set(1)
+	return
+}
+
+// constLabels returns the labels set on all the metrics of the API, see [WithServiceVersion] and
+// [WithEnvironment].
+func (ps *prometheusSink) constLabels() prometheus.Labels {
+	labels := prometheus.Labels{}
+	if ps.options.serviceVersion != "" {
+		labels[serviceVersionLabel] = ps.options.serviceVersion
+	}
+	if ps.options.environment != "" {
+		labels[environmentLabel] = ps.options.environment
+	}
+	return labels
+}
+
+// histogramOpts returns the options of a histogram of the API, including the native histogram
+// settings when they are enabled.
+func (ps *prometheusSink) histogramOpts(name, help string, buckets []float64) prometheus.HistogramOpts {
+	opts := prometheus.HistogramOpts{
+		Namespace:   ps.options.namespace,
+		ConstLabels: ps.constLabels(),
+		Name:        ps.metricName(name),
+		Help:        help,
+		Buckets:     buckets,
+	}
+	if factor := ps.options.nativeHistogramBucketFactor; factor > 1 {
+		opts.NativeHistogramBucketFactor = factor
+		opts.NativeHistogramMaxBucketNumber = nativeHistogramMaxBuckets
+		opts.NativeHistogramMinResetDuration = nativeHistogramMinResetDuration
+	}
+	return opts
+}
+
+// metricName returns the normalized name of a metric of the API.
+func (ps *prometheusSink) metricName(name string) string {
+	return normalize(fmt.Sprintf("%s_%s", ps.options.apiName, name))
+}
+
+// register registers the collector with the registry. If an identical collector is already
+// registered, the existing one is returned so it can be shared, unless the series of either
+// collector expire: a janitor would delete the series of the requests in flight of the other.
+func register[T prometheus.Collector](ps *prometheusSink, collector T) (T, error) {
+	err := ps.registry.Register(collector)
+	if err == nil {
+		if ps.options.seriesTTL > 0 {
+			ps.expiring = append(ps.expiring, collector)
+			expiringCollectors.Store(prometheus.Collector(collector), struct{}{})
+		}
+		return collector, nil
+	}
+
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			if _, expiring := expiringCollectors.Load(are.ExistingCollector); expiring || ps.options.seriesTTL > 0 {
+				return collector, fmt.Errorf("failed to share metric, as its series expire: %w", err)
+			}
+			return existing, nil
+		}
+	}
+	return collector, fmt.Errorf("failed to register metric: %w", err)
+}
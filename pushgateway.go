@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/twistingmercury/telemetry/v2/logging"
+)
+
+// pushTimeout bounds the duration of a single push to the Pushgateway.
+const pushTimeout = 10 * time.Second
+
+// pushgateway periodically pushes the metrics of a registry to a Prometheus Pushgateway, for
+// services that may not live long enough to be scraped.
+type pushgateway struct {
+	pusher   *push.Pusher
+	interval time.Duration
+
+	done      chan struct{}
+	closed    sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// newPushgateway creates the pushgateway of the registry; the metrics are only pushed periodically
+// once it is started.
+func newPushgateway(registry *prometheus.Registry, options metricsOptions) (*pushgateway, error) {
+	pusher := push.New(options.pushURL, options.pushJob).Gatherer(registry)
+	names := make([]string, 0, len(options.pushGrouping))
+	for name := range options.pushGrouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pusher = pusher.Grouping(name, options.pushGrouping[name])
+	}
+	if err := pusher.Error(); err != nil {
+		return nil, fmt.Errorf("invalid pushgateway grouping: %w", err)
+	}
+
+	return &pushgateway{pusher: pusher, interval: options.pushInterval, done: make(chan struct{})}, nil
+}
+
+// start starts pushing the metrics periodically.
+func (pg *pushgateway) start() {
+	pg.closed.Add(1)
+	go pg.pushPeriodically()
+}
+
+// push replaces the metrics of the grouping key on the Pushgateway with those of the registry.
+func (pg *pushgateway) push() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+	defer cancel()
+	return pg.pusher.PushContext(ctx)
+}
+
+func (pg *pushgateway) pushPeriodically() {
+	defer pg.closed.Done()
+	ticker := time.NewTicker(pg.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := pg.push(); err != nil {
+				logging.Error(context.Background(), err, "failed to push metrics to the pushgateway")
+			}
+		case <-pg.done:
+			return
+		}
+	}
+}
+
+// Close stops the periodic push and pushes the metrics one last time.
+func (pg *pushgateway) Close() (err error) {
+	pg.closeOnce.Do(func() {
+		close(pg.done)
+		pg.closed.Wait()
+		err = pg.push()
+	})
+	return
+}
@@ -0,0 +1,118 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twistingmercury/middleware/v2"
+)
+
+type pushedRequest struct {
+	method string
+	path   string
+	body   []byte
+}
+
+// pushgatewayStandIn returns a test server that records the requests pushed to it.
+func pushgatewayStandIn(t *testing.T) (*httptest.Server, func() []pushedRequest) {
+	var (
+		mu     sync.Mutex
+		pushed []pushedRequest
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		mu.Lock()
+		pushed = append(pushed, pushedRequest{method: r.Method, path: r.URL.Path, body: body})
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []pushedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]pushedRequest(nil), pushed...)
+	}
+}
+
+func TestPushgateway(t *testing.T) {
+	server, pushed := pushgatewayStandIn(t)
+
+	mc, err := middleware.NewMetricsCollector(prometheus.NewRegistry(),
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithPushgateway(server.URL, "batch", time.Hour),
+		middleware.WithPushGrouping(map[string]string{"instance": "worker-1"}))
+	require.NoError(t, err)
+
+	serveCollectorRequest(mc)
+	assert.Empty(t, pushed(), "nothing should be pushed before the interval elapses")
+
+	require.NoError(t, mc.Close())
+	require.NoError(t, mc.Close(), "closing twice should be a no-op")
+
+	requests := pushed()
+	require.Len(t, requests, 1, "the metrics should be pushed on close")
+	assert.Equal(t, http.MethodPut, requests[0].method)
+	assert.Equal(t, "/metrics/job/batch/instance/worker-1", requests[0].path)
+	assert.Contains(t, string(requests[0].body), "unit_test_total_calls")
+}
+
+func TestPushgatewayPushesPeriodically(t *testing.T) {
+	server, pushed := pushgatewayStandIn(t)
+
+	mc, err := middleware.NewMetricsCollector(prometheus.NewRegistry(),
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithPushgateway(server.URL, "batch", 10*time.Millisecond))
+	require.NoError(t, err)
+	defer mc.Close()
+
+	serveCollectorRequest(mc)
+	assert.Eventually(t, func() bool { return len(pushed()) >= 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestPushgatewayErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []middleware.MetricsOption
+	}{
+		{name: "empty job", opts: []middleware.MetricsOption{middleware.WithPushgateway("localhost:9091", " ", time.Second)}},
+		{name: "zero interval", opts: []middleware.MetricsOption{middleware.WithPushgateway("localhost:9091", "batch", 0)}},
+		{name: "invalid grouping label", opts: []middleware.MetricsOption{
+			middleware.WithPushgateway("localhost:9091", "batch", time.Second),
+			middleware.WithPushGrouping(map[string]string{"not-valid": "x"}),
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]middleware.MetricsOption{
+				middleware.WithNamespace(namespace),
+				middleware.WithAPIName(serviceName),
+			}, tc.opts...)
+			registry := prometheus.NewRegistry()
+			_, err := middleware.NewMetricsCollector(registry, opts...)
+			assert.Error(t, err)
+
+			// a gauge with the name of a metric of the collector conflicts with it, if registered
+			assert.NoError(t, registry.Register(prometheus.NewGauge(prometheus.GaugeOpts{Name: "unit_test_total_calls"})),
+				"the metrics should not be registered")
+		})
+	}
+}
+
+func TestPushgatewayRequiresCollector(t *testing.T) {
+	assert.Panics(t, func() {
+		middleware.PrometheusMetricsWithOptions(prometheus.NewRegistry(), namespace, serviceName,
+			middleware.WithPushgateway("localhost:9091", "batch", time.Second))
+	})
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/twistingmercury/telemetry/v2/logging"
+	otelCodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const ( // for panic properties
+	PanicValue = "panic.value"
+	PanicStack = "panic.stack"
+)
+
+// panicKey is the key of the [gin.Context] under which [Recovery] stores the recovered panic, so the
+// metrics middleware can count it.
+const panicKey = "github.com/twistingmercury/middleware/v2/panic"
+
+// Recovery returns the middleware that recovers from panics in the handlers. It responds with a 500
+// status, unless the response was already written, records the panic and its stack trace as an
+// exception event on the span of the request, and logs it as an error. The panic is counted by the
+// metrics middleware. Register it after the metrics, tracing and logging middlewares, so they
+// observe the 500 response instead of the panic.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+
+			stack := string(debug.Stack())
+			err, ok := r.(error)
+			if !ok {
+				err = fmt.Errorf("%v", r)
+			}
+			c.Set(panicKey, r)
+
+			ctx := c.Request.Context()
+			span := oteltrace.SpanFromContext(ctx)
+			span.AddEvent(semconv.ExceptionEventName, oteltrace.WithAttributes(
+				semconv.ExceptionType(fmt.Sprintf("%T", r)),
+				semconv.ExceptionMessage(err.Error()),
+				semconv.ExceptionStacktrace(stack),
+				semconv.ExceptionEscaped(false)))
+			span.SetStatus(otelCodes.Error, "panic")
+
+			logging.Error(ctx, err, "panic recovered",
+				logging.KeyValue{Key: PanicValue, Value: r},
+				logging.KeyValue{Key: PanicStack, Value: stack})
+
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}()
+
+		c.Next()
+	}
+}
+
+// panicked reports whether [Recovery] recovered from a panic in the handlers of the request.
+func panicked(c *gin.Context) bool {
+	_, ok := c.Get(panicKey)
+	return ok
+}
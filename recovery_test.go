@@ -0,0 +1,75 @@
+package middleware_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gonic "github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twistingmercury/middleware/v2"
+)
+
+func TestRecovery(t *testing.T) {
+	initializeTests(t)
+	defer resetTests()
+
+	registry := prometheus.NewRegistry()
+	mc, err := middleware.NewMetricsCollector(registry, middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName))
+	require.NoError(t, err)
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware(), middleware.OtelTracing(), middleware.Logging(), middleware.Recovery())
+	r.GET("/panic", func(c *gonic.Context) {
+		panic("something went wrong")
+	})
+
+	w := httptest.NewRecorder()
+	require.NotPanics(t, func() {
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	})
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+
+	assert.Equal(t, float64(1), gatherMetric(t, registry, "unit_test_panics_total").GetCounter().GetValue())
+	assert.Equal(t, []string{"500"}, labelValues(t, registry, "unit_test_total_calls", "http_status"))
+
+	entries := logEntries(t)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "error", entries[0]["level"])
+	assert.Equal(t, "something went wrong", entries[0][middleware.PanicValue])
+	assert.Contains(t, entries[0][middleware.PanicStack], "recovery_test.go")
+	assert.Contains(t, entries[0], "otel.trace_id")
+	assert.Equal(t, "error", entries[1]["level"])
+	assert.Equal(t, float64(http.StatusInternalServerError), entries[1][middleware.HttpStatus])
+}
+
+func TestRecoveryWithoutPanic(t *testing.T) {
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(middleware.Recovery())
+	r.GET("/test", func(c *gonic.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+// logEntries returns the entries written to the log buffer, one per line.
+func logEntries(t *testing.T) (entries []map[string]any) {
+	scanner := bufio.NewScanner(lbuffer)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	return
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// labelDeleter is implemented by the Prometheus metric vectors.
+type labelDeleter interface {
+	DeleteLabelValues(lvs ...string) bool
+}
+
+// expiringCollectors holds the Prometheus collectors registered by a [MetricsCollector] whose
+// series expire, which cannot be shared with other collectors, see [register].
+var expiringCollectors sync.Map
+
+type seriesKey struct {
+	vec    labelDeleter
+	values string
+}
+
+// trackedSeries is a series of a metric vector, along with the last time it was recorded.
+type trackedSeries struct {
+	values   []string
+	lastSeen time.Time
+	inFlight int // the requests in flight, for the series of the concurrent calls gauge
+}
+
+// seriesJanitor deletes the series of the metric vectors that have not been recorded for the TTL,
+// so label values that are no longer used, e.g. odd paths or retired tenants, stop being exported.
+type seriesJanitor struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	series map[seriesKey]*trackedSeries
+
+	done      chan struct{}
+	stopped   sync.WaitGroup
+	closeOnce sync.Once
+}
+
+func newSeriesJanitor(ttl time.Duration) *seriesJanitor {
+	sj := &seriesJanitor{ttl: ttl, series: make(map[seriesKey]*trackedSeries), done: make(chan struct{})}
+	sj.stopped.Add(1)
+	go sj.sweepPeriodically()
+	return sj
+}
+
+// touch records that the series of the vector was just recorded. The delta changes the requests in
+// flight of the series, which is not deleted while any is.
+func (sj *seriesJanitor) touch(vec labelDeleter, delta int, values ...string) {
+	key := seriesKey{vec: vec, values: strings.Join(values, "\xff")}
+
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	s, ok := sj.series[key]
+	if !ok {
+		s = &trackedSeries{values: values}
+		sj.series[key] = s
+	}
+	s.lastSeen = time.Now()
+	s.inFlight += delta
+}
+
+// sweep deletes the series that have not been recorded since the TTL before now.
+func (sj *seriesJanitor) sweep(now time.Time) {
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	for key, s := range sj.series {
+		if s.inFlight <= 0 && now.Sub(s.lastSeen) >= sj.ttl {
+			key.vec.DeleteLabelValues(s.values...)
+			delete(sj.series, key)
+		}
+	}
+}
+
+func (sj *seriesJanitor) sweepPeriodically() {
+	defer sj.stopped.Done()
+	ticker := time.NewTicker(max(sj.ttl/2, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			sj.sweep(now)
+		case <-sj.done:
+			return
+		}
+	}
+}
+
+// Close stops the janitor. The series are left as they are.
+func (sj *seriesJanitor) Close() {
+	sj.closeOnce.Do(func() {
+		close(sj.done)
+		sj.stopped.Wait()
+	})
+}
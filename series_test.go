@@ -0,0 +1,147 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gonic "github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twistingmercury/middleware/v2"
+)
+
+func TestMetricsCollectorSeriesTTL(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	mc, err := middleware.NewMetricsCollector(registry,
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithSeriesTTL(20*time.Millisecond))
+	require.NoError(t, err)
+	defer mc.Close()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware())
+	r.GET("/users/:id", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/slow", func(c *gonic.Context) {
+		close(started)
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+	require.Equal(t, []string{"/users/:id"}, labelValues(t, registry, "unit_test_total_calls", "http_path"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-started
+
+	assert.Eventually(t, func() bool {
+		return len(labelValues(t, registry, "unit_test_total_calls", "http_path")) == 0
+	}, time.Second, 5*time.Millisecond, "the unused series should be deleted")
+	assert.Equal(t, []string{"/slow"}, labelValues(t, registry, "unit_test_concurrent_calls", "http_path"),
+		"the series of the requests in flight should be kept")
+
+	close(release)
+	<-done
+}
+
+func TestMetricsCollectorNegativeSeriesTTL(t *testing.T) {
+	_, err := middleware.NewMetricsCollector(prometheus.NewRegistry(),
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithSeriesTTL(-time.Second))
+	assert.Error(t, err)
+}
+
+func TestMetricsCollectorSeriesTTLReleasesCardinality(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	mc, err := middleware.NewMetricsCollector(registry,
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithPathLabelMode(middleware.RawPathLabel),
+		middleware.WithCardinalityLimit(1),
+		middleware.WithSeriesTTL(20*time.Millisecond))
+	require.NoError(t, err)
+	defer mc.Close()
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware())
+	r.GET("/users/:id", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/2", nil))
+	require.ElementsMatch(t, []string{"/users/1", middleware.OverflowLabelValue},
+		labelValues(t, registry, "unit_test_total_calls", "http_path"))
+
+	assert.Eventually(t, func() bool {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/3", nil))
+		return assert.ObjectsAreEqual([]string{"/users/3"}, labelValues(t, registry, "unit_test_total_calls", "http_path"))
+	}, time.Second, 5*time.Millisecond, "the expired value should free its slot")
+}
+
+func TestSeriesTTLRequiresCollector(t *testing.T) {
+	assert.Panics(t, func() {
+		middleware.PrometheusMetricsWithOptions(prometheus.NewRegistry(), namespace, serviceName,
+			middleware.WithSeriesTTL(time.Minute))
+	})
+}
+
+func TestSeriesTTLSharedMetrics(t *testing.T) {
+	options := func(ttl time.Duration) []middleware.MetricsOption {
+		return []middleware.MetricsOption{
+			middleware.WithNamespace(namespace),
+			middleware.WithAPIName(serviceName),
+			middleware.WithSeriesTTL(ttl),
+		}
+	}
+
+	t.Run("shared by a collector with a ttl", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		_, err := middleware.NewMetricsCollector(registry, options(0)...)
+		require.NoError(t, err)
+		_, err = middleware.NewMetricsCollector(registry, options(time.Minute)...)
+		assert.Error(t, err)
+	})
+
+	t.Run("shared with a collector with a ttl", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		mc, err := middleware.NewMetricsCollector(registry, options(time.Minute)...)
+		require.NoError(t, err)
+		_, err = middleware.NewMetricsCollector(registry, options(0)...)
+		assert.Error(t, err)
+
+		require.NoError(t, mc.Close())
+		_, err = middleware.NewMetricsCollector(registry, options(0)...)
+		assert.NoError(t, err, "the metrics can be shared once the collector is closed")
+	})
+
+	t.Run("failed collector with a ttl", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		// a gauge with the descriptor of the total calls counter, which cannot be shared
+		conflict := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "unit_test_total_calls",
+			Help: "The count of all call to the API, grouped by path, http method, and status code"},
+			[]string{"http_path", "http_method", "http_status"})
+		require.NoError(t, registry.Register(conflict))
+		_, err := middleware.NewMetricsCollector(registry, options(time.Minute)...)
+		require.Error(t, err)
+
+		registry.Unregister(conflict)
+		_, err = middleware.NewMetricsCollector(registry, options(0)...)
+		assert.NoError(t, err, "the metrics registered by the failed collector can be shared")
+	})
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Objective is the service level objective of a route, see [WithRouteObjective].
+type Objective struct {
+	// Latency is the Apdex threshold T of the route: requests handled within T are satisfied, within
+	// 4T tolerating, and slower ones or errors frustrated. Requests handled within T without an error
+	// are good events of the SLO. The errors are the status codes mapped to an error by the
+	// [StatusMapper] of the collector, i.e. 5xx by default.
+	Latency time.Duration
+
+	// Availability is the target ratio of good events, e.g. 0.999. It is exported along with the
+	// events, so the error budget burn rate can be computed without recording rules.
+	Availability float64
+}
+
+const ( // the Apdex zones of a request
+	apdexSatisfied  = "satisfied"
+	apdexTolerating = "tolerating"
+	apdexFrustrated = "frustrated"
+)
+
+// apdexToleratingFactor is the multiple of the Apdex threshold up to which requests are tolerating.
+const apdexToleratingFactor = 4
+
+func (o Objective) validate() error {
+	switch {
+	case o.Latency <= 0:
+		return errors.New("objective latency must be greater than 0")
+	case o.Availability <= 0 || o.Availability >= 1:
+		return fmt.Errorf("objective availability %v must be between 0 and 1", o.Availability)
+	}
+	return nil
+}
+
+// evaluate returns the Apdex zone of a request handled by the route, and whether it is a good
+// event of the SLO. Failed requests, see [StatusMapper], are frustrated.
+func (o Objective) evaluate(failed bool, duration time.Duration) (zone string, good bool) {
+	switch {
+	case failed:
+		return apdexFrustrated, false
+	case duration <= o.Latency:
+		return apdexSatisfied, true
+	case duration <= apdexToleratingFactor*o.Latency:
+		return apdexTolerating, false
+	default:
+		return apdexFrustrated, false
+	}
+}
+
+// objective returns the objective of the route, and false if it has none. Unmatched requests have
+// no objective.
+func (o metricsOptions) objective(route string) (Objective, bool) {
+	if route == "" {
+		return Objective{}, false
+	}
+	if objective, ok := o.routeObjectives[route]; ok {
+		return objective, true
+	}
+	if o.defaultObjective != nil {
+		return *o.defaultObjective, true
+	}
+	return Objective{}, false
+}
@@ -0,0 +1,157 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gonic "github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twistingmercury/middleware/v2"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// serveObjectiveRequests serves a satisfied, a tolerating, a frustrated request, and a request
+// without objective, through the middleware of the collector.
+func serveObjectiveRequests(mc *middleware.MetricsCollector) {
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware())
+	r.GET("/fast", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/slow", func(c *gonic.Context) {
+		time.Sleep(15 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	r.GET("/failing", func(c *gonic.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+	r.GET("/untracked", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/fast", "/slow", "/failing", "/untracked", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+}
+
+func objectiveOptions() []middleware.MetricsOption {
+	return []middleware.MetricsOption{
+		middleware.WithRouteObjective("/fast", middleware.Objective{Latency: time.Hour, Availability: 0.999}),
+		middleware.WithRouteObjective("/slow", middleware.Objective{Latency: 10 * time.Millisecond, Availability: 0.99}),
+		middleware.WithRouteObjective("/failing", middleware.Objective{Latency: time.Hour, Availability: 0.999}),
+	}
+}
+
+func TestMetricsCollectorObjectives(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	opts := append([]middleware.MetricsOption{middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName)}, objectiveOptions()...)
+	mc, err := middleware.NewMetricsCollector(registry, opts...)
+	require.NoError(t, err)
+
+	serveObjectiveRequests(mc)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	apdex := make(map[string]string)
+	good := make(map[string]float64)
+	total := make(map[string]float64)
+	objective := make(map[string]float64)
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			switch mf.GetName() {
+			case "unit_test_apdex_total":
+				apdex[labels["http_path"]] = labels["apdex_zone"]
+			case "unit_test_slo_good_events_total":
+				good[labels["http_path"]] = m.GetCounter().GetValue()
+			case "unit_test_slo_events_total":
+				total[labels["http_path"]] = m.GetCounter().GetValue()
+			case "unit_test_slo_objective_ratio":
+				objective[labels["http_path"]] = m.GetGauge().GetValue()
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]string{"/fast": "satisfied", "/slow": "tolerating", "/failing": "frustrated"}, apdex)
+	assert.Equal(t, map[string]float64{"/fast": 1, "/slow": 1, "/failing": 1}, total)
+	assert.Equal(t, map[string]float64{"/fast": 1, "/slow": 0, "/failing": 0}, good)
+	assert.Equal(t, map[string]float64{"/fast": 0.999, "/slow": 0.99, "/failing": 0.999}, objective)
+}
+
+func TestMetricsCollectorDefaultObjective(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	mc, err := middleware.NewMetricsCollector(registry,
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithDefaultObjective(middleware.Objective{Latency: time.Hour, Availability: 0.9}))
+	require.NoError(t, err)
+
+	serveObjectiveRequests(mc)
+
+	assert.ElementsMatch(t, []string{"/fast", "/slow", "/failing", "/untracked"},
+		labelValues(t, registry, "unit_test_slo_events_total", "http_path"),
+		"unmatched requests should have no objective")
+}
+
+func TestOtelMetricsCollectorObjectives(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	mc, err := middleware.NewOtelMetricsCollector(provider, objectiveOptions()...)
+	require.NoError(t, err)
+
+	serveObjectiveRequests(mc)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	metrics := make(map[string]metricdata.Metrics)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+
+	apdex, ok := metrics["http.server.apdex"].Data.(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, apdex.DataPoints, 3)
+
+	good, ok := metrics["http.server.slo.good_events"].Data.(metricdata.Sum[int64])
+	require.True(t, ok)
+	goodEvents := make(map[string]int64)
+	for _, dp := range good.DataPoints {
+		route, _ := dp.Attributes.Value("http.route")
+		goodEvents[route.AsString()] = dp.Value
+	}
+	assert.Equal(t, map[string]int64{"/fast": 1, "/slow": 0, "/failing": 0}, goodEvents)
+
+	objective, ok := metrics["http.server.slo.objective"].Data.(metricdata.Gauge[float64])
+	require.True(t, ok)
+	assert.Len(t, objective.DataPoints, 3)
+}
+
+func TestMetricsCollectorInvalidObjectives(t *testing.T) {
+	testCases := []struct {
+		name string
+		opt  middleware.MetricsOption
+	}{
+		{name: "zero latency", opt: middleware.WithRouteObjective("/fast", middleware.Objective{Availability: 0.99})},
+		{name: "zero availability", opt: middleware.WithRouteObjective("/fast", middleware.Objective{Latency: time.Second})},
+		{name: "full availability", opt: middleware.WithDefaultObjective(middleware.Objective{Latency: time.Second, Availability: 1})},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := middleware.NewMetricsCollector(prometheus.NewRegistry(),
+				middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName), tc.opt)
+			assert.Error(t, err)
+		})
+	}
+}
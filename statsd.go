@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsDFormat is the line format used to send the metrics to a StatsD server.
+type StatsDFormat int
+
+const (
+	// StatsDTags sends the labels as tags appended to the metric name, e.g.
+	// `api.total_calls,http_method=GET:1|c`, as understood by Telegraf. This is the default.
+	StatsDTags StatsDFormat = iota
+
+	// DogStatsDTags sends the labels in the DogStatsD format, e.g. `api.total_calls:1|c|#http_method:GET`.
+	DogStatsDTags
+)
+
+const ( // for StatsD defaults
+	defaultStatsDFlushInterval = time.Second
+	defaultStatsDMaxPacketSize = 1432 // fits the payload of a UDP packet on a 1500 bytes MTU network
+)
+
+// statsdSink sends the metrics of a [MetricsCollector] to a StatsD server over UDP. The lines are
+// buffered and sent in batches, either when a packet is full or when the flush interval elapses.
+type statsdSink struct {
+	conn       net.Conn
+	options    metricsOptions
+	prefix     string
+	labelNames []string
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	inFlight map[string]int64 // the concurrent calls, by gauge line prefix
+
+	done      chan struct{}
+	closed    sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewStatsDMetricsCollector creates a [MetricsCollector] that sends the concurrent calls, total
+// calls and call duration metrics to the StatsD server listening on the UDP address, e.g.
+// `127.0.0.1:8125`. The metric names are prefixed with the namespace and the API name, when set.
+// Use [WithStatsDFormat], [WithStatsDFlushInterval] and [WithStatsDMaxPacketSize] to configure the
+// sink, and [MetricsCollector.Close] to flush the buffered metrics on shutdown.
+func NewStatsDMetricsCollector(addr string, opts ...MetricsOption) (*MetricsCollector, error) {
+	options := newMetricsOptions(opts...)
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	sink, err := newStatsDSink(addr, options)
+	if err != nil {
+		return nil, err
+	}
+	return newMetricsCollector(options, sink), nil
+}
+
+func newStatsDSink(addr string, options metricsOptions) (*statsdSink, error) {
+	switch {
+	case strings.TrimSpace(addr) == "":
+		return nil, errors.New("statsd address is empty")
+	case options.statsdFlushInterval <= 0:
+		return nil, errors.New("statsd flush interval must be greater than 0")
+	case options.statsdMaxPacketSize <= 0:
+		return nil, errors.New("statsd max packet size must be greater than 0")
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd: %w", err)
+	}
+
+	var prefix []string
+	for _, p := range []string{options.namespace, options.apiName} {
+		if strings.TrimSpace(p) != "" {
+			prefix = append(prefix, normalize(p))
+		}
+	}
+
+	sink := &statsdSink{
+		conn:       conn,
+		options:    options,
+		prefix:     strings.Join(prefix, "."),
+		labelNames: options.labelNames(),
+		inFlight:   make(map[string]int64),
+		done:       make(chan struct{}),
+	}
+	sink.closed.Add(1)
+	go sink.flushPeriodically()
+	return sink, nil
+}
+
+func (sink *statsdSink) requestStarted(_ context.Context, req requestInfo) {
+	sink.addConcurrentCalls(req, 1)
+}
+
+func (sink *statsdSink) requestFinished(_ context.Context, req requestInfo, res requestResult) {
+	sink.addConcurrentCalls(req, -1)
+
+	tags := []string{pathLabel, req.path, methodLabel, req.method, statusLabel, strconv.Itoa(res.status)}
+	if sink.options.statusClassLabel {
+		tags = append(tags, statusClassLabel, statusClass(res.status))
+	}
+	tags = sink.appendLabels(tags, req)
+
+	duration := strconv.FormatFloat(float64(res.duration)/float64(time.Millisecond), 'f', -1, 64)
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.write(sink.line("total_calls", "1", "c", tags))
+	sink.write(sink.line("call_duration", duration, "ms", tags))
+}
+
+func (sink *statsdSink) labelOverflowed(_ context.Context, label string) {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.write(sink.line("label_overflows_total", "1", "c", []string{overflowLabel, label}))
+}
+
+// addConcurrentCalls updates the count of concurrent calls and sends it as an absolute gauge value,
+// as DogStatsD does not support relative gauge updates.
+func (sink *statsdSink) addConcurrentCalls(req requestInfo, delta int64) {
+	tags := sink.appendLabels([]string{pathLabel, req.path, methodLabel, req.method}, req)
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	key := strings.Join(tags, "\x00")
+	sink.inFlight[key] += delta
+	value := sink.inFlight[key]
+	if value == 0 {
+		delete(sink.inFlight, key)
+	}
+	sink.write(sink.line("concurrent_calls", strconv.FormatInt(value, 10), "g", tags))
+}
+
+// appendLabels appends the names and values of the custom labels of the request to the tags.
+func (sink *statsdSink) appendLabels(tags []string, req requestInfo) []string {
+	for i, name := range sink.labelNames {
+		tags = append(tags, name, req.labels[i])
+	}
+	return tags
+}
+
+// line formats a metric line; tags holds the names and values of the tags, in turn.
+func (sink *statsdSink) line(name, value, metricType string, tags []string) string {
+	if sink.prefix != "" {
+		name = sink.prefix + "." + name
+	}
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	if sink.options.statsdFormat == DogStatsDTags {
+		sb.WriteString(":" + value + "|" + metricType)
+		for i := 0; i < len(tags); i += 2 {
+			sep := ","
+			if i == 0 {
+				sep = "|#"
+			}
+			sb.WriteString(sep + tags[i] + ":" + sanitizeStatsDTag(tags[i+1], ""))
+		}
+		return sb.String()
+	}
+
+	for i := 0; i < len(tags); i += 2 {
+		sb.WriteString("," + tags[i] + "=" + sanitizeStatsDTag(tags[i+1], ":="))
+	}
+	sb.WriteString(":" + value + "|" + metricType)
+	return sb.String()
+}
+
+// sanitizeStatsDTag replaces the characters that delimit the parts of a line in a tag value.
+func sanitizeStatsDTag(value, reserved string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune("|,#\n "+reserved, r) {
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// write appends the line to the buffer, sending the buffer first if the line does not fit in the
+// current packet. The caller must hold the lock.
+func (sink *statsdSink) write(line string) {
+	if sink.buf.Len() > 0 && sink.buf.Len()+1+len(line) > sink.options.statsdMaxPacketSize {
+		sink.send()
+	}
+	if sink.buf.Len() > 0 {
+		sink.buf.WriteByte('\n')
+	}
+	sink.buf.WriteString(line)
+}
+
+// send sends the buffered lines in one packet. Errors are ignored, as UDP delivery is best effort
+// anyway. The caller must hold the lock.
+func (sink *statsdSink) send() {
+	if sink.buf.Len() == 0 {
+		return
+	}
+	_, _ = sink.conn.Write(sink.buf.Bytes())
+	sink.buf.Reset()
+}
+
+func (sink *statsdSink) flushPeriodically() {
+	defer sink.closed.Done()
+	ticker := time.NewTicker(sink.options.statsdFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sink.mu.Lock()
+			sink.send()
+			sink.mu.Unlock()
+		case <-sink.done:
+			return
+		}
+	}
+}
+
+// Close stops the periodic flush, sends the buffered metrics and closes the connection.
+func (sink *statsdSink) Close() (err error) {
+	sink.closeOnce.Do(func() {
+		close(sink.done)
+		sink.closed.Wait()
+
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		sink.send()
+		err = sink.conn.Close()
+	})
+	return
+}
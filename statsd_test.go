@@ -0,0 +1,122 @@
+package middleware_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gonic "github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twistingmercury/middleware/v2"
+)
+
+func TestStatsDMetricsCollector(t *testing.T) {
+	testCases := []struct {
+		name     string
+		format   middleware.StatsDFormat
+		expected []string
+	}{
+		{
+			name:   "statsd",
+			format: middleware.StatsDTags,
+			expected: []string{
+				"unit.test.concurrent_calls,http_path=/users/_id,http_method=GET:1|g",
+				"unit.test.concurrent_calls,http_path=/users/_id,http_method=GET:0|g",
+				"unit.test.total_calls,http_path=/users/_id,http_method=GET,http_status=200:1|c",
+			},
+		},
+		{
+			name:   "dogstatsd",
+			format: middleware.DogStatsDTags,
+			expected: []string{
+				"unit.test.concurrent_calls:1|g|#http_path:/users/:id,http_method:GET",
+				"unit.test.concurrent_calls:0|g|#http_path:/users/:id,http_method:GET",
+				"unit.test.total_calls:1|c|#http_path:/users/:id,http_method:GET,http_status:200",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer conn.Close()
+
+			mc, err := middleware.NewStatsDMetricsCollector(conn.LocalAddr().String(),
+				middleware.WithNamespace(namespace),
+				middleware.WithAPIName(serviceName),
+				middleware.WithStatsDFormat(tc.format),
+				middleware.WithStatsDFlushInterval(time.Hour))
+			require.NoError(t, err)
+
+			serveCollectorRequest(mc)
+			require.NoError(t, mc.Close())
+			require.NoError(t, mc.Close(), "closing twice should be a no-op")
+
+			packets := readPackets(t, conn)
+			require.Len(t, packets, 1, "the lines should be batched in one packet")
+			lines := strings.Split(packets[0], "\n")
+			require.Len(t, lines, 4)
+			assert.Equal(t, tc.expected, lines[:3])
+			assert.Contains(t, lines[3], "unit.test.call_duration")
+			assert.Contains(t, lines[3], "|ms")
+		})
+	}
+}
+
+func TestStatsDMetricsCollectorFlushes(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	mc, err := middleware.NewStatsDMetricsCollector(conn.LocalAddr().String(),
+		middleware.WithStatsDFlushInterval(10*time.Millisecond),
+		middleware.WithStatsDMaxPacketSize(100))
+	require.NoError(t, err)
+	defer mc.Close()
+
+	serveCollectorRequest(mc)
+
+	packets := readPackets(t, conn)
+	require.Greater(t, len(packets), 1, "the lines should be split in several packets")
+	for _, p := range packets {
+		assert.LessOrEqual(t, len(p), 100)
+	}
+}
+
+func TestNewStatsDMetricsCollectorValidation(t *testing.T) {
+	_, err := middleware.NewStatsDMetricsCollector("")
+	assert.Error(t, err)
+
+	_, err = middleware.NewStatsDMetricsCollector("127.0.0.1:8125", middleware.WithStatsDFlushInterval(0))
+	assert.Error(t, err)
+}
+
+// serveCollectorRequest serves a request to the /users/:id route through the middleware of the collector.
+func serveCollectorRequest(mc *middleware.MetricsCollector) {
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware())
+	r.GET("/users/:id", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/42", nil))
+}
+
+// readPackets reads the packets received by the listener until none arrives for 100ms.
+func readPackets(t *testing.T, conn net.PacketConn) (packets []string) {
+	buf := make([]byte, 65536)
+	for {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		packets = append(packets, string(buf[:n]))
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+
+	otelCodes "go.opentelemetry.io/otel/codes"
+)
+
+// StatusMapper maps the HTTP status code of a response to the status of the span of the request.
+// The requests whose status is mapped to [otelCodes.Error] are also logged as failed, and count
+// against the objective of their route, see [WithRouteObjective].
+type StatusMapper interface {
+	SpanStatus(status int) (code otelCodes.Code, desc string)
+}
+
+// StatusMapperFunc is an adapter to use a func as a [StatusMapper].
+type StatusMapperFunc func(status int) (code otelCodes.Code, desc string)
+
+// SpanStatus calls f(status).
+func (f StatusMapperFunc) SpanStatus(status int) (code otelCodes.Code, desc string) {
+	return f(status)
+}
+
+// httpStatusMapper is the [StatusMapper] returned by [DefaultStatusMapper].
+type httpStatusMapper struct {
+	errorCodes map[int]bool
+}
+
+// DefaultStatusMapper returns the [StatusMapper] following the OpenTelemetry guidance for HTTP
+// server spans: 5xx status codes are errors, and the other status codes leave the span status
+// unset, as they are caused by the client. The errorCodes are additional status codes to treat as
+// errors, e.g. 429.
+func DefaultStatusMapper(errorCodes ...int) StatusMapper {
+	m := httpStatusMapper{errorCodes: make(map[int]bool, len(errorCodes))}
+	for _, status := range errorCodes {
+		m.errorCodes[status] = true
+	}
+	return m
+}
+
+func (m httpStatusMapper) SpanStatus(status int) (code otelCodes.Code, desc string) {
+	if status >= 500 || m.errorCodes[status] {
+		return otelCodes.Error, http.StatusText(status)
+	}
+	return otelCodes.Unset, ""
+}
+
+// failed reports whether the mapper maps the status code to an error.
+func failed(mapper StatusMapper, status int) bool {
+	code, _ := mapper.SpanStatus(status)
+	return code == otelCodes.Error
+}
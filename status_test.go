@@ -0,0 +1,98 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gonic "github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twistingmercury/middleware/v2"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestDefaultStatusMapper(t *testing.T) {
+	testCases := []struct {
+		name       string
+		errorCodes []int
+		status     int
+		expected   codes.Code
+	}{
+		{name: "ok", status: http.StatusOK, expected: codes.Unset},
+		{name: "redirect", status: http.StatusFound, expected: codes.Unset},
+		{name: "not found", status: http.StatusNotFound, expected: codes.Unset},
+		{name: "too many requests", status: http.StatusTooManyRequests, expected: codes.Unset},
+		{name: "too many requests as error", errorCodes: []int{http.StatusTooManyRequests}, status: http.StatusTooManyRequests, expected: codes.Error},
+		{name: "client closed request", status: middleware.StatusClientClosedRequest, expected: codes.Unset},
+		{name: "internal server error", status: http.StatusInternalServerError, expected: codes.Error},
+		{name: "not implemented", status: http.StatusNotImplemented, expected: codes.Error},
+		{name: "gateway timeout", status: http.StatusGatewayTimeout, expected: codes.Error},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, desc := middleware.DefaultStatusMapper(tc.errorCodes...).SpanStatus(tc.status)
+			assert.Equal(t, tc.expected, code)
+			if code == codes.Error {
+				assert.Equal(t, http.StatusText(tc.status), desc)
+			} else {
+				assert.Empty(t, desc)
+			}
+		})
+	}
+}
+
+func TestStatusMapperIsUsedByAllMiddlewares(t *testing.T) {
+	spans := recordSpans(t)
+	defer resetTests()
+
+	mapper := middleware.WithStatusMapper(middleware.DefaultStatusMapper(http.StatusTooManyRequests))
+	registry := prometheus.NewRegistry()
+	mc, err := middleware.NewMetricsCollector(registry,
+		middleware.WithNamespace(namespace),
+		middleware.WithAPIName(serviceName),
+		middleware.WithRouteObjective("/limited", middleware.Objective{Latency: time.Hour, Availability: 0.99}),
+		mapper)
+	require.NoError(t, err)
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware(), middleware.OtelTracingWithOptions(mapper), middleware.LoggingWithOptions(mapper))
+	r.GET("/limited", func(c *gonic.Context) {
+		c.Status(http.StatusTooManyRequests)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/limited", nil))
+
+	stubs := spans()
+	require.Len(t, stubs, 1)
+	assert.Equal(t, codes.Error, stubs[0].Status.Code)
+	assert.Equal(t, "Too Many Requests", stubs[0].Status.Description)
+
+	entries := logEntries(t)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "error", entries[0]["level"])
+
+	assert.Equal(t, []string{"frustrated"}, labelValues(t, registry, "unit_test_apdex_total", "apdex_zone"))
+}
+
+func TestOtelTracingLeavesClientErrorsUnset(t *testing.T) {
+	spans := recordSpans(t)
+	defer resetTests()
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(middleware.OtelTracing())
+	r.GET("/missing", func(c *gonic.Context) {
+		c.Status(http.StatusNotFound)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	stubs := spans()
+	require.Len(t, stubs, 1)
+	assert.Equal(t, codes.Unset, stubs[0].Status.Code)
+}
@@ -0,0 +1,151 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gonic "github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twistingmercury/middleware/v2"
+	"github.com/twistingmercury/telemetry/v2/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans initializes the tests with an in-memory trace exporter, and returns a func that
+// returns the spans ended so far.
+func recordSpans(t *testing.T) func() tracetest.SpanStubs {
+	initializeTests(t)
+	exporter := tracetest.NewInMemoryExporter()
+	require.NoError(t, tracing.Initialize(exporter, serviceName, serviceVersion, environment))
+
+	return func() tracetest.SpanStubs {
+		tp, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider)
+		require.True(t, ok)
+		require.NoError(t, tp.ForceFlush(context.Background()))
+		return exporter.GetSpans()
+	}
+}
+
+// spanAttributes returns the attributes of the span as a set.
+func spanAttributes(span tracetest.SpanStub) attribute.Set {
+	return attribute.NewSet(span.Attributes...)
+}
+
+func TestOtelTracingServerSpanAttributes(t *testing.T) {
+	spans := recordSpans(t)
+	defer resetTests()
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(middleware.OtelTracing())
+	r.GET("/users/:id", func(c *gonic.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://api.example.com:8080/users/42", nil)
+	req.RemoteAddr = "10.1.2.3:51234"
+	req.Header.Set("User-Agent", "unit-test/1.0")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	stubs := spans()
+	require.Len(t, stubs, 1)
+	attrs := spanAttributes(stubs[0])
+	assertAttribute(t, attrs, "http.request.method", attribute.StringValue(http.MethodGet))
+	assertAttribute(t, attrs, "url.path", attribute.StringValue("/users/42"))
+	assertAttribute(t, attrs, "url.scheme", attribute.StringValue("http"))
+	assertAttribute(t, attrs, "http.route", attribute.StringValue("/users/:id"))
+	assertAttribute(t, attrs, "http.response.status_code", attribute.IntValue(http.StatusCreated))
+	assertAttribute(t, attrs, "server.address", attribute.StringValue("api.example.com"))
+	assertAttribute(t, attrs, "server.port", attribute.IntValue(8080))
+	assertAttribute(t, attrs, "client.address", attribute.StringValue("10.1.2.3"))
+	assertAttribute(t, attrs, "user_agent.original", attribute.StringValue("unit-test/1.0"))
+	assertAttribute(t, attrs, "network.protocol.version", attribute.StringValue("1.1"))
+}
+
+func TestOtelTracingUnknownMethod(t *testing.T) {
+	spans := recordSpans(t)
+	defer resetTests()
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(middleware.OtelTracing())
+	r.Handle("PURGE", "/cache", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/cache", nil))
+
+	stubs := spans()
+	require.Len(t, stubs, 1)
+	attrs := spanAttributes(stubs[0])
+	assertAttribute(t, attrs, "http.request.method", attribute.StringValue("_OTHER"))
+	assertAttribute(t, attrs, "http.request.method_original", attribute.StringValue("PURGE"))
+	assertAttribute(t, attrs, "server.port", attribute.IntValue(80))
+	_, ok := attrs.Value("user_agent.original")
+	assert.False(t, ok, "the user agent should not be set when the request has none")
+}
+
+func TestOtelTracingSpanName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		expected string
+	}{
+		{name: "matched route", method: http.MethodGet, path: "/users/42", expected: "GET /users/:id"},
+		{name: "unmatched route", method: http.MethodGet, path: "/missing", expected: "GET"},
+		{name: "unknown method", method: "PURGE", path: "/users/42", expected: "HTTP /users/:id"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			spans := recordSpans(t)
+			defer resetTests()
+
+			gonic.SetMode(gonic.TestMode)
+			r := gonic.New()
+			r.Use(middleware.OtelTracing())
+			r.Handle(tc.method, "/users/:id", func(c *gonic.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tc.method, tc.path, nil))
+
+			stubs := spans()
+			require.Len(t, stubs, 1)
+			assert.Equal(t, tc.expected, stubs[0].Name)
+		})
+	}
+}
+
+func TestOtelTracingWithOptions(t *testing.T) {
+	spans := recordSpans(t)
+	defer resetTests()
+
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(middleware.OtelTracingWithOptions(
+		middleware.WithExcludedPaths("/health"),
+		middleware.WithSpanNameFormatter(func(c *gonic.Context) string {
+			return "users " + middleware.DefaultSpanName(c)
+		})))
+	r.GET("/users/:id", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/health", func(c *gonic.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	stubs := spans()
+	require.Len(t, stubs, 1)
+	assert.Equal(t, "users GET /users/:id", stubs[0].Name)
+}
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StatusClientClosedRequest is the status recorded for requests whose client went away before the
+// response was written, following the convention of nginx.
+const StatusClientClosedRequest = 499
+
+// responseWriter wraps the [gin.ResponseWriter] of a request to record when the first byte of the
+// response is written, and whether writing it failed. It is shared by the middlewares of the
+// package, see [trackResponse].
+type responseWriter struct {
+	gin.ResponseWriter
+	firstByte time.Time
+	writeErr  error
+
+	beforeWrite []func() // called once, right before the headers are written
+}
+
+// trackResponse wraps the writer of the request in a [responseWriter], unless a middleware of the
+// package has already done so, and returns it.
+func trackResponse(c *gin.Context) *responseWriter {
+	if w, ok := c.Writer.(*responseWriter); ok {
+		return w
+	}
+	w := &responseWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	return w
+}
+
+func (w *responseWriter) markFirstByte() {
+	w.runBeforeWrite()
+	if w.firstByte.IsZero() {
+		w.firstByte = time.Now()
+	}
+}
+
+// onBeforeWrite registers a func to call right before the response headers are written, e.g. to
+// add headers. If the handlers do not write the response, gin writes the headers once they return,
+// without going through the writer, so the middlewares call [responseWriter.runBeforeWrite] after
+// the handlers.
+func (w *responseWriter) onBeforeWrite(fn func()) {
+	w.beforeWrite = append(w.beforeWrite, fn)
+}
+
+// runBeforeWrite calls the funcs registered with [responseWriter.onBeforeWrite], once.
+func (w *responseWriter) runBeforeWrite() {
+	fns := w.beforeWrite
+	w.beforeWrite = nil
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+func (w *responseWriter) WriteHeaderNow() {
+	w.markFirstByte()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *responseWriter) Write(data []byte) (n int, err error) {
+	w.markFirstByte()
+	n, err = w.ResponseWriter.Write(data)
+	w.recordError(err)
+	return
+}
+
+func (w *responseWriter) WriteString(s string) (n int, err error) {
+	w.markFirstByte()
+	n, err = w.ResponseWriter.WriteString(s)
+	w.recordError(err)
+	return
+}
+
+func (w *responseWriter) recordError(err error) {
+	if err != nil && w.writeErr == nil {
+		w.writeErr = err
+	}
+}
+
+func (w *responseWriter) Flush() {
+	w.markFirstByte()
+	w.ResponseWriter.Flush()
+}
+
+// Unwrap returns the wrapped writer, so [http.ResponseController] reaches the features of the
+// underlying writer, e.g. write deadlines.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// firstByteAt returns when the first byte of the response was written. If the handlers did not
+// write the response, gin writes the headers once they return, so the current time is returned.
+func (w *responseWriter) firstByteAt() time.Time {
+	if w.firstByte.IsZero() {
+		return time.Now()
+	}
+	return w.firstByte
+}
+
+// clientDisconnected reports whether the client of the request went away: the request context was
+// canceled, or writing the response failed, e.g. with a broken pipe.
+func clientDisconnected(c *gin.Context) bool {
+	if errors.Is(c.Request.Context().Err(), context.Canceled) {
+		return true
+	}
+	w, ok := c.Writer.(*responseWriter)
+	return ok && w.writeErr != nil
+}
+
+// responseStatus returns the status of the response, or [StatusClientClosedRequest] if the client
+// went away.
+func responseStatus(c *gin.Context) int {
+	if clientDisconnected(c) {
+		return StatusClientClosedRequest
+	}
+	return c.Writer.Status()
+}
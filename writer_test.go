@@ -0,0 +1,111 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	gonic "github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twistingmercury/middleware/v2"
+)
+
+// brokenPipeWriter is a [http.ResponseWriter] whose client went away.
+type brokenPipeWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w brokenPipeWriter) Write([]byte) (int, error) {
+	return 0, syscall.EPIPE
+}
+
+func TestClientDisconnected(t *testing.T) {
+	testCases := []struct {
+		name  string
+		serve func(r *gonic.Engine)
+	}{
+		{
+			name: "canceled context",
+			serve: func(r *gonic.Engine) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				req := httptest.NewRequest(http.MethodGet, "/test", nil).WithContext(ctx)
+				r.ServeHTTP(httptest.NewRecorder(), req)
+			},
+		},
+		{
+			name: "broken pipe",
+			serve: func(r *gonic.Engine) {
+				req := httptest.NewRequest(http.MethodGet, "/test", nil)
+				r.ServeHTTP(brokenPipeWriter{httptest.NewRecorder()}, req)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			initializeTests(t)
+			defer resetTests()
+
+			registry := prometheus.NewRegistry()
+			mc, err := middleware.NewMetricsCollector(registry, middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName))
+			require.NoError(t, err)
+
+			gonic.SetMode(gonic.TestMode)
+			r := gonic.New()
+			r.Use(mc.Middleware(), middleware.OtelTracing(), middleware.Logging())
+			r.GET("/test", func(c *gonic.Context) {
+				c.String(http.StatusOK, "too late")
+			})
+			tc.serve(r)
+
+			assert.Equal(t, []string{"499"}, labelValues(t, registry, "unit_test_total_calls", "http_status"))
+
+			entries := logEntries(t)
+			require.Len(t, entries, 1)
+			assert.Equal(t, "warn", entries[0]["level"])
+			assert.Equal(t, true, entries[0][middleware.HttpClientDisconnected])
+			assert.Equal(t, float64(middleware.StatusClientClosedRequest), entries[0][middleware.HttpStatus])
+		})
+	}
+}
+
+// deadlineWriter is a [http.ResponseWriter] that supports write deadlines.
+type deadlineWriter struct {
+	*httptest.ResponseRecorder
+	deadline time.Time
+}
+
+func (w *deadlineWriter) SetWriteDeadline(deadline time.Time) error {
+	w.deadline = deadline
+	return nil
+}
+
+func TestResponseController(t *testing.T) {
+	initializeTests(t)
+	defer resetTests()
+
+	registry := prometheus.NewRegistry()
+	mc, err := middleware.NewMetricsCollector(registry, middleware.WithNamespace(namespace), middleware.WithAPIName(serviceName))
+	require.NoError(t, err)
+
+	deadline := time.Now().Add(time.Minute)
+	gonic.SetMode(gonic.TestMode)
+	r := gonic.New()
+	r.Use(mc.Middleware(), middleware.OtelTracing(), middleware.Logging())
+	r.GET("/test", func(c *gonic.Context) {
+		assert.NoError(t, http.NewResponseController(c.Writer).SetWriteDeadline(deadline))
+		c.Status(http.StatusOK)
+	})
+
+	w := &deadlineWriter{ResponseRecorder: httptest.NewRecorder()}
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, deadline.Equal(w.deadline), "the deadline should reach the underlying writer")
+}